@@ -11,7 +11,13 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/farouqzaib/fast-search/internal/analyzer"
+	"github.com/farouqzaib/fast-search/internal/chunking"
+	"github.com/farouqzaib/fast-search/internal/embedding"
+	"github.com/farouqzaib/fast-search/internal/index"
+	"github.com/farouqzaib/fast-search/internal/rerank"
 	"github.com/farouqzaib/fast-search/internal/server"
 	"github.com/farouqzaib/fast-search/internal/storage"
 	"github.com/hashicorp/raft"
@@ -19,10 +25,31 @@ import (
 )
 
 var (
-	joinAddr string
-	raftAddr string
-	httpAddr string
-	nodeId   string
+	joinAddr       string
+	raftAddr       string
+	httpAddr       string
+	nodeId         string
+	maxExpansions  int
+	analyzerConfig string
+	storeOffsets   bool
+	stopwords      string
+	embedder       string
+	embeddingURL   string
+	embeddingModel string
+	embeddingDims  int
+	batchSize      int
+	workers        int
+	cacheSize      int
+	cachePath      string
+	callTimeout    time.Duration
+	retries        int
+	reranker       string
+	rerankURL      string
+	rerankTimeout  time.Duration
+	chunkStrategy  string
+	chunkSize      int
+	chunkOverlap   int
+	sparseURL      string
 )
 
 func main() {
@@ -30,6 +57,27 @@ func main() {
 	flag.StringVar(&joinAddr, "joinAddr", "", "HTTP API service address of primary node to join")
 	flag.StringVar(&nodeId, "nodeId", "", "unique identifier for node")
 	flag.StringVar(&raftAddr, "raftAddr", "", "raft address for node")
+	flag.IntVar(&maxExpansions, "maxExpansions", index.DefaultMaxExpansions, "maximum number of terms a wildcard query term expands to")
+	flag.StringVar(&analyzerConfig, "analyzerConfig", "", "path to a JSON analyzer config, the default English analyzer is used if empty")
+	flag.BoolVar(&storeOffsets, "storeOffsets", false, "store the character offsets of tokens in postings to speed up highlighting")
+	flag.StringVar(&stopwords, "stopwords", "", "path to a stopword list with one word per line, or none to disable stopwords; the analyzer config is used if empty")
+	flag.StringVar(&embedder, "embedder", embedding.FastAPIProvider, "embedding provider: fastapi, openai or hashing")
+	flag.StringVar(&embeddingURL, "embeddingURL", os.Getenv("EmbeddingHost"), "URL of the fastapi embedding service or base URL of the OpenAI-compatible API, defaults to $EmbeddingHost")
+	flag.StringVar(&embeddingModel, "embeddingModel", "", "model requested from the OpenAI-compatible API")
+	flag.IntVar(&embeddingDims, "embeddingDimensions", embedding.DefaultDimensions, "size of the vectors of the hashing embedder")
+	flag.IntVar(&batchSize, "embeddingBatchSize", index.DefaultBatchSize, "number of documents embedded per request when bulk indexing")
+	flag.IntVar(&workers, "embeddingWorkers", index.DefaultBulkWorkers, "number of embedding requests in flight when bulk indexing")
+	flag.IntVar(&cacheSize, "embeddingCacheSize", 10000, "number of text embeddings cached in memory, 0 to disable the cache")
+	flag.StringVar(&cachePath, "embeddingCachePath", "", "path to a bbolt file persisting cached embeddings across restarts, kept in memory only if empty")
+	flag.DurationVar(&callTimeout, "embeddingTimeout", embedding.DefaultCallTimeout, "deadline of each call to the embedding service")
+	flag.IntVar(&retries, "embeddingRetries", embedding.DefaultRetries, "number of retries of a failed call to the embedding service")
+	flag.StringVar(&chunkStrategy, "chunking", "", "chunking strategy: tokens, sentences or window, documents are embedded whole if empty")
+	flag.IntVar(&chunkSize, "chunkSize", chunking.DefaultSize, "maximum number of words of a chunk")
+	flag.IntVar(&chunkOverlap, "chunkOverlap", chunking.DefaultOverlap, "number of words shared by consecutive chunks of the window strategy")
+	flag.StringVar(&sparseURL, "sparseEmbeddingURL", "", "URL of the fastapi embedding service whose /sparse route computes sparse vectors, only given sparse vectors are used if empty")
+	flag.StringVar(&reranker, "reranker", "", "reranking provider: fastapi or lexical, reranking is disabled if empty")
+	flag.StringVar(&rerankURL, "rerankURL", os.Getenv("RerankHost"), "URL of the /rerank route of the fastapi service, defaults to $RerankHost")
+	flag.DurationVar(&rerankTimeout, "rerankTimeout", rerank.DefaultTimeout, "deadline of each call to the reranker, after which results keep their fused order")
 	flag.Parse()
 
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
@@ -39,6 +87,74 @@ func main() {
 	config.Raft.LocalID = raft.ServerID(nodeId)
 	config.Addr = raftAddr
 	config.RaftDir = "internal/storage/raft"
+	config.Index.MaxExpansions = maxExpansions
+	config.Index.StoreOffsets = storeOffsets
+
+	embeddingConfig := embedding.Config{
+		Provider:   embedder,
+		URL:        embeddingURL,
+		Model:      embeddingModel,
+		APIKey:     os.Getenv("EMBEDDING_API_KEY"),
+		Dimensions: embeddingDims,
+	}
+
+	e, err := embedding.New(embeddingConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	e = embedding.NewResilient(e, embedding.ResilientConfig{Timeout: callTimeout, Retries: retries})
+
+	if cacheSize > 0 || cachePath != "" {
+		var cacheStorage *bolt.DB
+		if cachePath != "" {
+			cacheStorage, err = bolt.Open(cachePath, 0600, nil)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer cacheStorage.Close()
+		}
+
+		e, err = embedding.NewCache(e, cacheSize, cacheStorage, embeddingConfig.Namespace())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	config.Index.Embedder = e
+	config.Index.EmbeddingBatchSize = batchSize
+	config.Index.EmbeddingWorkers = workers
+
+	if sparseURL != "" {
+		config.Index.SparseEmbedder = embedding.NewFastAPI(sparseURL)
+	}
+
+	config.Index.Chunker, err = chunking.New(chunking.Config{Strategy: chunkStrategy, Size: chunkSize, Overlap: chunkOverlap})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if analyzerConfig != "" || stopwords != "" {
+		var err error
+		c := analyzer.DefaultConfig()
+
+		if analyzerConfig != "" {
+			c, err = analyzer.LoadConfig(analyzerConfig)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if stopwords != "" {
+			err = setStopwords(&c, stopwords)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		config.Index.Analyzer, err = analyzer.New(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	if joinAddr == "" {
 		config.Raft.Bootstrap = true
@@ -65,7 +181,16 @@ func main() {
 
 	defer metadataStorage.Close()
 
-	srv := server.NewHttpServer(indexStorage, metadataStorage, logger, httpAddr)
+	var r rerank.Reranker
+	if reranker != "" {
+		r, err = rerank.New(rerank.Config{Provider: reranker, URL: rerankURL})
+		if err != nil {
+			log.Fatal(err)
+		}
+		r = rerank.NewTimeout(r, rerankTimeout)
+	}
+
+	srv := server.NewHttpServer(indexStorage, metadataStorage, r, logger, httpAddr)
 	logger.Info("starting server")
 
 	signalCh := make(chan os.Signal, 1)
@@ -98,3 +223,34 @@ func main() {
 	indexStorage.DB.FlushMemtables()
 
 }
+
+// setStopwords points every stop filter of c to a stopword file, or disables
+// them when stopwords is "none", keeping their other parameters.
+func setStopwords(c *analyzer.Config, stopwords string) error {
+	for i, f := range c.Filters {
+		if f.Type != "stop" {
+			continue
+		}
+
+		params := map[string]interface{}{}
+		if len(f.Params) > 0 {
+			if err := json.Unmarshal(f.Params, &params); err != nil {
+				return err
+			}
+		}
+
+		if stopwords == "none" {
+			params["disabled"] = true
+		} else {
+			params["path"] = stopwords
+		}
+
+		b, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		c.Filters[i].Params = b
+	}
+
+	return nil
+}
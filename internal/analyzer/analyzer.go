@@ -3,49 +3,349 @@ package analyzer
 import (
 	"strings"
 	"unicode"
-
-	snowballeng "github.com/kljensen/snowball/english"
 )
 
 // Credit: https://artem.krylysov.com/blog/2020/07/28/lets-build-a-full-text-search-engine/
 
+// Token is a single term emitted by a tokenizer along with its position in
+// the token stream and the byte offsets of the text it was read from.
+type Token struct {
+	Term     string
+	Position int
+	Start    int
+	End      int
+}
+
+// CharFilter rewrites raw text before it is tokenized.
+type CharFilter interface {
+	Filter(text string) string
+}
+
+// OffsetCharFilter is implemented by char filters that add or remove text,
+// so the offsets of tokens can be mapped back to the original text. Char
+// filters that do not implement it must keep offsets unchanged.
+type OffsetCharFilter interface {
+	FilterOffsets(text string) (string, *OffsetMap)
+}
+
+// Tokenizer splits text into tokens.
+type Tokenizer interface {
+	Tokenize(text string) []Token
+}
+
+// TokenFilter adds, removes or rewrites tokens.
+type TokenFilter interface {
+	Filter(tokens []Token) []Token
+}
+
+// TextTokenFilter is implemented by token filters that need the text tokens
+// were read from, such as filters splitting a token whose term may have been
+// rewritten by an earlier filter. Token offsets refer to text.
+type TextTokenFilter interface {
+	FilterText(text string, tokens []Token) []Token
+}
+
+// Normalizer is implemented by token filters that only change the form of
+// each term, such as lowercasing. They are the only filters applied to
+// wildcard patterns.
+type Normalizer interface {
+	Normalize(term string) string
+}
+
+// UnicodeNormalizer is implemented by token filters that normalize the
+// Unicode form of terms. Normalization names the normalization applied.
+type UnicodeNormalizer interface {
+	Normalization() string
+}
+
+// Stemmer is implemented by token filters that reduce terms to their stem.
+type Stemmer interface {
+	Stem(term string) string
+}
+
+// LanguageAware is implemented by token filters whose behaviour depends on
+// the language of the text, such as stopword removal and stemming.
+type LanguageAware interface {
+	ForLanguage(code string) TokenFilter
+}
+
+// QueryExpander is implemented by token filters that expand a query into
+// alternative token sequences, such as synonyms.
+type QueryExpander interface {
+	Variants(tokens []Token) [][]Token
+}
+
+// Analyzer turns text into terms: the text is passed through every char
+// filter, split by the tokenizer and the resulting tokens passed through
+// every token filter in order.
+//
+// An analyzer configured with the auto language detects the language of
+// every text and analyzes it with the language-aware filters switched to
+// that language.
+type Analyzer struct {
+	charFilters []CharFilter
+	tokenizer   Tokenizer
+	filters     []TokenFilter
+	config      Config
+	variants    map[string]*Analyzer
+}
+
+var defaultAnalyzer = mustNew(DefaultConfig())
+
+// Default returns the analyzer used when none has been configured: standard
+// tokenization, NFC normalization, lowercasing, an initially empty synonym
+// set, English stopword removal and English stemming.
+func Default() *Analyzer {
+	return defaultAnalyzer
+}
+
+// Analyze runs text through the default analyzer.
 func Analyze(text string) []string {
-	tokens := tokenize(text)
-	tokens = lowercaseFilter(tokens)
-	tokens = stopwordFilter(tokens)
-	tokens = stemmerFilter(tokens)
-	return tokens
+	return defaultAnalyzer.Analyze(text)
+}
+
+func (a *Analyzer) Config() Config {
+	return a.config
 }
 
-func tokenize(text string) []string {
-	return strings.FieldsFunc(text, func(r rune) bool {
-		// Split on any character that is not a letter or a number.
-		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+// DetectLanguage returns the language text is analyzed in, or an empty
+// string if the analyzer does not detect languages.
+func (a *Analyzer) DetectLanguage(text string) string {
+	if a.config.Language != AutoLanguage {
+		return ""
+	}
+	return DetectLanguage(text)
+}
+
+// MinDetectionWords is the least number of words a query needs for its
+// language to be detected. Shorter queries have too few n-grams to tell
+// languages apart.
+const MinDetectionWords = 3
+
+// QueryLanguage returns the language query is analyzed in, or an empty
+// string if the analyzer does not detect languages. Queries shorter than
+// MinDetectionWords are taken to be in fallback, or English without one.
+func (a *Analyzer) QueryLanguage(query string, fallback string) string {
+	if a.config.Language != AutoLanguage {
+		return ""
+	}
+
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r)
 	})
+	if len(words) >= MinDetectionWords {
+		return DetectLanguage(query)
+	}
+
+	if fallback != "" {
+		return fallback
+	}
+	return "en"
 }
 
-func lowercaseFilter(tokens []string) []string {
-	r := make([]string, len(tokens))
-	for i, token := range tokens {
-		r[i] = strings.ToLower(token)
+// ForLanguage returns the analyzer used for text in language. Analyzers that
+// do not detect languages always return themselves.
+func (a *Analyzer) ForLanguage(code string) *Analyzer {
+	if v, ok := a.variants[code]; ok {
+		return v
 	}
-	return r
+	return a
 }
 
-func stopwordFilter(tokens []string) []string {
-	r := make([]string, 0, len(tokens))
-	for _, token := range tokens {
-		if _, ok := english[token]; !ok {
-			r = append(r, token)
+// withLanguage copies the analyzer, switching every language-aware filter
+// to language.
+func (a *Analyzer) withLanguage(code string) *Analyzer {
+	config := a.config
+	config.Language = code
+
+	v := &Analyzer{charFilters: a.charFilters, tokenizer: a.tokenizer, config: config}
+	for _, f := range a.filters {
+		if l, ok := f.(LanguageAware); ok {
+			f = l.ForLanguage(code)
 		}
+		v.filters = append(v.filters, f)
 	}
-	return r
+
+	return v
+}
+
+func (a *Analyzer) Tokens(text string) []Token {
+	if lang := a.DetectLanguage(text); lang != "" {
+		return a.ForLanguage(lang).Tokens(text)
+	}
+
+	filtered, offsets := a.filterText(text)
+
+	tokens := a.tokenizer.Tokenize(filtered)
+	for _, f := range a.filters {
+		if t, ok := f.(TextTokenFilter); ok {
+			tokens = t.FilterText(filtered, tokens)
+			continue
+		}
+		tokens = f.Filter(tokens)
+	}
+
+	//token offsets always refer to the original text
+	if offsets != nil {
+		for j := range tokens {
+			tokens[j].Start = offsets.Start(tokens[j].Start)
+			tokens[j].End = offsets.End(tokens[j].End)
+		}
+	}
+
+	return tokens
+}
+
+// filterText runs text through every char filter, returning the map of the
+// filtered text back to text, or nil if no offsets changed.
+func (a *Analyzer) filterText(text string) (string, *OffsetMap) {
+	var offsets *OffsetMap
+
+	for _, f := range a.charFilters {
+		if o, ok := f.(OffsetCharFilter); ok {
+			var m *OffsetMap
+			text, m = o.FilterOffsets(text)
+			offsets = offsets.then(m)
+			continue
+		}
+		text = f.Filter(text)
+	}
+
+	return text, offsets
+}
+
+func (a *Analyzer) Analyze(text string) []string {
+	return terms(a.Tokens(text))
+}
+
+// QueryVariants analyzes a query into every alternative token sequence it
+// expands to. Filters that expand queries are applied to each sequence in
+// turn, the others filter every sequence as usual.
+func (a *Analyzer) QueryVariants(text string) [][]Token {
+	if lang := a.DetectLanguage(text); lang != "" {
+		return a.ForLanguage(lang).QueryVariants(text)
+	}
+
+	for _, f := range a.charFilters {
+		text = f.Filter(text)
+	}
+
+	variants := [][]Token{a.tokenizer.Tokenize(text)}
+	for _, f := range a.filters {
+		expanded := [][]Token{}
+		for _, tokens := range variants {
+			if e, ok := f.(QueryExpander); ok {
+				expanded = append(expanded, e.Variants(tokens)...)
+				continue
+			}
+			expanded = append(expanded, f.Filter(tokens))
+		}
+		variants = expanded
+	}
+
+	return variants
+}
+
+// Normalization names the Unicode normalizations applied to terms in order,
+// e.g. "nfkc+ascii_folding", or is empty if terms are not normalized.
+func (a *Analyzer) Normalization() string {
+	names := []string{}
+	for _, f := range a.filters {
+		if n, ok := f.(UnicodeNormalizer); ok {
+			names = append(names, n.Normalization())
+		}
+	}
+	return strings.Join(names, "+")
+}
+
+// Stopwords returns the stopword set of the analyzer, or nil if it has no
+// stop filter.
+func (a *Analyzer) Stopwords() *StopwordSet {
+	for _, f := range a.filters {
+		if s, ok := f.(stopFilter); ok {
+			return s.set
+		}
+	}
+	return nil
+}
+
+// StopwordsFingerprint identifies the stopwords removed by the analyzer.
+func (a *Analyzer) StopwordsFingerprint() string {
+	if s := a.Stopwords(); s != nil {
+		return s.Fingerprint()
+	}
+	return NoStopwords
+}
+
+// Synonyms returns the synonym set of the analyzer, or nil if it has no
+// synonym filter.
+func (a *Analyzer) Synonyms() *SynonymSet {
+	for _, f := range a.filters {
+		if s, ok := f.(*synonymFilter); ok {
+			return s.set
+		}
+	}
+	return nil
+}
+
+// Words returns the terms of text without stemming them or adding synonyms.
+// Unlike Analyze it keeps their surface form, which is what users expect to
+// see when their input is completed.
+func (a *Analyzer) Words(text string) []string {
+	if lang := a.DetectLanguage(text); lang != "" {
+		return a.ForLanguage(lang).Words(text)
+	}
+
+	for _, f := range a.charFilters {
+		text = f.Filter(text)
+	}
+
+	tokens := a.tokenizer.Tokenize(text)
+	for _, f := range a.filters {
+		switch f.(type) {
+		case Stemmer, QueryExpander:
+			continue
+		}
+		tokens = f.Filter(tokens)
+	}
+
+	return terms(tokens)
+}
+
+// AnalyzeWildcard splits text like the standard tokenizer but keeps the '*'
+// and '?' metacharacters. Tokens only go through normalizing filters:
+// stopword removal and stemming would mangle the wildcard portion of a
+// pattern.
+func (a *Analyzer) AnalyzeWildcard(text string) []string {
+	for _, f := range a.charFilters {
+		text = f.Filter(text)
+	}
+
+	tokens := strings.FieldsFunc(text, func(r rune) bool {
+		return !isLetter(r) && !unicode.IsNumber(r) && r != '*' && r != '?'
+	})
+
+	for j, token := range tokens {
+		for _, f := range a.filters {
+			if n, ok := f.(Normalizer); ok {
+				token = n.Normalize(token)
+			}
+		}
+		tokens[j] = token
+	}
+
+	return tokens
+}
+
+// IsWildcard reports whether token contains a wildcard metacharacter.
+func IsWildcard(token string) bool {
+	return strings.ContainsAny(token, "*?")
 }
 
-func stemmerFilter(tokens []string) []string {
+func terms(tokens []Token) []string {
 	r := make([]string, len(tokens))
 	for i, token := range tokens {
-		r[i] = snowballeng.Stem(token, false)
+		r[i] = token.Term
 	}
 	return r
 }
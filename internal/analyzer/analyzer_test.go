@@ -0,0 +1,479 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	expected := []string{"batman", "save", "gotham"}
+
+	got := Analyze("Batman is saving Gotham!")
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	var config Config
+	err := json.Unmarshal([]byte(`{
+		"charFilters": [{"type": "mapping", "params": {"mappings": {"C++": "cpp"}}}],
+		"tokenizer": "whitespace",
+		"filters": ["lowercase", {"type": "stop", "params": {"words": ["and"]}}]
+	}`), &config)
+	if err != nil {
+		t.Fatalf("config unmarshal returned an error: %v", err)
+	}
+
+	a, err := New(config)
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	expected := []string{"c#", "cpp", "part-no.42"}
+
+	got := a.Analyze("C# and C++ PART-NO.42")
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestNewUnknownComponent(t *testing.T) {
+	_, err := New(Config{Tokenizer: ComponentConfig{Type: "nope"}})
+
+	if err == nil {
+		t.Fatalf("expected an error for an unknown tokenizer")
+	}
+}
+
+func TestWordDelimiterFilter(t *testing.T) {
+	a, err := New(Config{
+		Tokenizer: ComponentConfig{Type: "standard"},
+		Filters:   []ComponentConfig{{Type: "word_delimiter"}, {Type: "lowercase"}},
+	})
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	expected := []Token{
+		{Term: "parse", Position: 0, Start: 0, End: 5},
+		{Term: "http", Position: 1, Start: 5, End: 9},
+		{Term: "response", Position: 2, Start: 9, End: 17},
+		{Term: "2", Position: 3, Start: 17, End: 18},
+		{Term: "body", Position: 4, Start: 19, End: 23},
+	}
+
+	got := a.Tokens("parseHTTPResponse2 body")
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestWordDelimiterFilterFolded(t *testing.T) {
+	a, err := New(Config{
+		Tokenizer: ComponentConfig{Type: "standard"},
+		Filters:   []ComponentConfig{{Type: "ascii_folding"}, {Type: "word_delimiter"}, {Type: "lowercase"}},
+	})
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	//folding shortens the term in bytes, offsets still refer to the text
+	expected := []Token{
+		{Term: "cafe", Position: 0, Start: 0, End: 5},
+		{Term: "menu", Position: 1, Start: 5, End: 10},
+		{Term: "strasse", Position: 2, Start: 11, End: 19},
+		{Term: "2", Position: 3, Start: 11, End: 19},
+	}
+
+	got := a.Tokens("caféMenü Straße2")
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestWords(t *testing.T) {
+	expected := []string{"batman", "saving", "gotham"}
+
+	got := Default().Words("Batman is saving Gotham!")
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	texts := map[string]string{
+		"The quick brown fox jumps over the lazy dog while the farmer watches from his house": "en",
+		"Le chat est assis sur le tapis et regarde les oiseaux dans le jardin":                "fr",
+		"El perro corre por el parque con su dueño todas las mañanas":                         "es",
+		"Собака бежит по парку со своим хозяином каждое утро":                                 "ru",
+		"A kutya minden reggel a parkban fut a gazdájával":                                    "hu",
+	}
+
+	for text, expected := range texts {
+		got := DetectLanguage(text)
+
+		if expected != got {
+			t.Fatalf("expected %v for %q, got %v", expected, text, got)
+		}
+	}
+}
+
+func TestAutoLanguage(t *testing.T) {
+	config := DefaultConfig()
+	config.Language = AutoLanguage
+
+	a, err := New(config)
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	expected := []string{"le", "chat", "regardent", "le", "oiseau", "jardin"}
+
+	got := a.Analyze("Les chats regardent les oiseaux dans le jardin")
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestStandardTokenizerCJK(t *testing.T) {
+	expected := []Token{
+		{Term: "rust", Position: 0, Start: 0, End: 4},
+		{Term: "语言", Position: 1, Start: 4, End: 10},
+		{Term: "言编", Position: 2, Start: 7, End: 13},
+		{Term: "编程", Position: 3, Start: 10, End: 16},
+		{Term: "東", Position: 4, Start: 18, End: 21},
+		{Term: "テス", Position: 5, Start: 22, End: 28},
+		{Term: "スト", Position: 6, Start: 25, End: 31},
+	}
+
+	got := Default().Tokens("Rust语言编程, 東 テスト")
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestSynonymQueryVariants(t *testing.T) {
+	a, err := New(Config{
+		Tokenizer: ComponentConfig{Type: "standard"},
+		Filters: []ComponentConfig{
+			{Type: "lowercase"},
+			{Type: "synonym", Params: json.RawMessage(`{"rules": ["k8s, kubernetes", "nyc => new york"]}`)},
+			{Type: "stemmer"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	expected := [][]Token{
+		{{Term: "k8s", Position: 0, Start: 0, End: 3}, {Term: "in", Position: 1, Start: 4, End: 6}, {Term: "new", Position: 2, Start: 7, End: 10}, {Term: "york", Position: 3, Start: 7, End: 10}, {Term: "cluster", Position: 4, Start: 11, End: 19}},
+		{{Term: "kubernet", Position: 0, Start: 0, End: 3}, {Term: "in", Position: 1, Start: 4, End: 6}, {Term: "new", Position: 2, Start: 7, End: 10}, {Term: "york", Position: 3, Start: 7, End: 10}, {Term: "cluster", Position: 4, Start: 11, End: 19}},
+	}
+
+	got := a.QueryVariants("K8s in NYC clusters")
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestSynonymIndexTime(t *testing.T) {
+	a, err := New(Config{
+		Tokenizer: ComponentConfig{Type: "standard"},
+		Filters: []ComponentConfig{
+			{Type: "lowercase"},
+			{Type: "synonym", Params: json.RawMessage(`{"rules": ["new york, nyc"], "indexTime": true}`)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	expected := []Token{
+		{Term: "new", Position: 0, Start: 0, End: 3},
+		{Term: "york", Position: 1, Start: 4, End: 8},
+		{Term: "nyc", Position: 0, Start: 0, End: 8},
+		{Term: "pizza", Position: 2, Start: 9, End: 14},
+	}
+
+	got := a.Tokens("New York pizza")
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	if words := a.Words("New York pizza"); len(words) != 3 {
+		t.Fatalf("expected synonyms not to be completed, got %v", words)
+	}
+}
+
+func TestSynonymSetInvalidRule(t *testing.T) {
+	s, err := NewSynonymSet([]string{"tv, television"})
+	if err != nil {
+		t.Fatalf("new synonym set returned an error: %v", err)
+	}
+
+	if err := s.Set([]string{"a => b => c"}); err == nil {
+		t.Fatalf("expected an error for a rule with two =>")
+	}
+
+	expected := []string{"tv, television"}
+	if got := s.Rules(); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestHTMLStripCharFilter(t *testing.T) {
+	a, err := New(Config{
+		CharFilters: []ComponentConfig{{Type: "html_strip"}},
+		Tokenizer:   ComponentConfig{Type: "standard"},
+		Filters:     []ComponentConfig{{Type: "lowercase"}},
+	})
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	text := `<p class="intro">Caf&eacute; <b>au</b>lait</p><script>var x = 1;</script><!-- note --><li>a &lt; b</li>`
+
+	expected := []Token{
+		{Term: "café", Position: 0, Start: 17, End: 28},
+		{Term: "aulait", Position: 1, Start: 32, End: 42},
+		{Term: "a", Position: 2, Start: 90, End: 91},
+		{Term: "b", Position: 3, Start: 97, End: 98},
+	}
+
+	got := a.Tokens(text)
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	if text[got[1].Start:got[1].End] != "au</b>lait" {
+		t.Fatalf("expected offsets to map to the original text, got %q", text[got[1].Start:got[1].End])
+	}
+}
+
+func TestMarkdownStripCharFilter(t *testing.T) {
+	a, err := New(Config{
+		CharFilters: []ComponentConfig{{Type: "markdown_strip"}},
+		Tokenizer:   ComponentConfig{Type: "whitespace"},
+	})
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	text := "## Install\n\n- run **go get** see [the docs](https://example.com/docs)\n```bash\nmake snake_case\n```\n[docs]: https://example.com"
+
+	expected := []string{"Install", "run", "go", "get", "see", "the", "docs", "make", "snake_case"}
+
+	got := a.Analyze(text)
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	tokens := a.Tokens(text)
+	if docs := tokens[6]; text[docs.Start:docs.End] != "docs" {
+		t.Fatalf("expected offsets to map to the original text, got %q", text[docs.Start:docs.End])
+	}
+}
+
+func TestMappingCharFilterOffsets(t *testing.T) {
+	a, err := New(Config{
+		CharFilters: []ComponentConfig{
+			{Type: "html_strip"},
+			{Type: "mapping", Params: json.RawMessage(`{"mappings": {"C++": "cpp"}}`)},
+		},
+		Tokenizer: ComponentConfig{Type: "standard"},
+	})
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	text := "<i>C&#43;&#43;</i> rocks"
+
+	expected := []Token{
+		{Term: "cpp", Position: 0, Start: 3, End: 14},
+		{Term: "rocks", Position: 1, Start: 19, End: 24},
+	}
+
+	got := a.Tokens(text)
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestNormalizeFilter(t *testing.T) {
+	composed, decomposed := "Café", "Cafe\u0301"
+
+	if got, expected := Analyze(decomposed), Analyze(composed); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	a, err := New(Config{
+		Tokenizer: ComponentConfig{Type: "standard"},
+		Filters: []ComponentConfig{
+			{Type: "normalize", Params: json.RawMessage(`{"form": "nfkc"}`)},
+			{Type: "lowercase"},
+			{Type: "ascii_folding"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	expected := []string{"cafe", "strasse", "file", "ab12"}
+
+	got := a.Analyze(decomposed + " Straße ﬁle ＡＢ１２")
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	if got := a.Normalization(); got != "nfkc+ascii_folding" {
+		t.Fatalf("expected %v, got %v", "nfkc+ascii_folding", got)
+	}
+
+	if got := a.AnalyzeWildcard("CAFÉ*"); !reflect.DeepEqual([]string{"cafe*"}, got) {
+		t.Fatalf("expected %v, got %v", []string{"cafe*"}, got)
+	}
+}
+
+func TestASCIIFoldingPreserveOriginal(t *testing.T) {
+	a, err := New(Config{
+		Tokenizer: ComponentConfig{Type: "whitespace"},
+		Filters:   []ComponentConfig{{Type: "ascii_folding", Params: json.RawMessage(`{"preserveOriginal": true}`)}},
+	})
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	expected := []Token{
+		{Term: "naïve", Position: 0, Start: 0, End: 6},
+		{Term: "naive", Position: 0, Start: 0, End: 6},
+		{Term: "plan", Position: 1, Start: 7, End: 11},
+	}
+
+	got := a.Tokens("naïve plan")
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestStopwordsFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stopwords.txt")
+	if err := os.WriteFile(path, []byte("# legal\nhereby\n\nwhereas\n"), 0644); err != nil {
+		t.Fatalf("write returned an error: %v", err)
+	}
+
+	a, err := New(Config{
+		Tokenizer: ComponentConfig{Type: "standard"},
+		Filters: []ComponentConfig{
+			{Type: "lowercase"},
+			{Type: "stop", Params: json.RawMessage(`{"path": "` + path + `"}`)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	expected := []string{"the", "who", "agree"}
+
+	got := a.Analyze("Whereas The Who hereby agree")
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestStopwordSet(t *testing.T) {
+	config := DefaultConfig()
+	config.Language = AutoLanguage
+
+	a, err := New(config)
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	set := a.Stopwords()
+	if got := set.Fingerprint(); got != DefaultStopwords {
+		t.Fatalf("expected %v, got %v", DefaultStopwords, got)
+	}
+
+	set.SetDisabled(true)
+
+	expected := []string{"the", "who"}
+	if got := a.Analyze("The Who"); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	set.SetDisabled(false)
+	set.Set([]string{"chats"})
+
+	//custom stopwords apply to every detected language
+	expected = []string{"le", "regardent", "le", "oiseau", "dans", "le", "jardin"}
+	if got := a.Analyze("Les chats regardent les oiseaux dans le jardin"); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	if got := set.Fingerprint(); got == DefaultStopwords || got == DisabledStopwords {
+		t.Fatalf("expected a fingerprint of the custom words, got %v", got)
+	}
+}
+
+func TestQueryLanguage(t *testing.T) {
+	config := DefaultConfig()
+	config.Language = AutoLanguage
+
+	a, err := New(config)
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	queries := []struct {
+		query, fallback, expected string
+	}{
+		{"jardin fleuri", "fr", "fr"},
+		{"jardin fleuri", "", "en"},
+		{"Les chats regardent les oiseaux", "en", "fr"},
+	}
+
+	for _, q := range queries {
+		if got := a.QueryLanguage(q.query, q.fallback); got != q.expected {
+			t.Fatalf("expected %v for %q, got %v", q.expected, q.query, got)
+		}
+	}
+
+	if got := Default().QueryLanguage("jardin fleuri", "fr"); got != "" {
+		t.Fatalf("expected no language without detection, got %v", got)
+	}
+}
+
+func TestConfigEqual(t *testing.T) {
+	var config Config
+	if err := json.Unmarshal([]byte(`{"tokenizer": {"type": "standard"}, "filters": ["normalize", "lowercase", "synonym", "stop", {"type": "stemmer"}]}`), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if !config.Equal(DefaultConfig()) {
+		t.Fatalf("expected %v, got %v", DefaultConfig(), config)
+	}
+
+	config.Language = AutoLanguage
+	if config.Equal(DefaultConfig()) {
+		t.Fatalf("expected %v to differ from %v", config, DefaultConfig())
+	}
+}
@@ -0,0 +1,398 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// mappingCharFilter replaces every occurrence of a key with its value, e.g.
+// to keep "c++" from being reduced to "c" by the tokenizer.
+type mappingCharFilter struct {
+	keys     []string
+	mappings map[string]string
+}
+
+func newMappingCharFilter(params json.RawMessage) (CharFilter, error) {
+	var p struct {
+		Mappings map[string]string `json:"mappings"`
+	}
+
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	if len(p.Mappings) == 0 {
+		return nil, errors.New("no mappings configured")
+	}
+
+	//longest keys first so overlapping keys resolve deterministically
+	keys := make([]string, 0, len(p.Mappings))
+	for k := range p.Mappings {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	return mappingCharFilter{keys: keys, mappings: p.Mappings}, nil
+}
+
+func (f mappingCharFilter) Filter(text string) string {
+	text, _ = f.FilterOffsets(text)
+	return text
+}
+
+func (f mappingCharFilter) FilterOffsets(text string) (string, *OffsetMap) {
+	var o offsetBuilder
+
+	for i := 0; i < len(text); {
+		key := f.match(text[i:])
+		if key == "" {
+			o.copy(text, i, i+1)
+			i++
+			continue
+		}
+
+		o.replace(f.mappings[key], i, i+len(key))
+		i += len(key)
+	}
+
+	return o.result(text)
+}
+
+func (f mappingCharFilter) match(text string) string {
+	for _, key := range f.keys {
+		if key != "" && strings.HasPrefix(text, key) {
+			return key
+		}
+	}
+	return ""
+}
+
+// htmlStripCharFilter removes HTML tags and comments, drops the contents of
+// script and style elements and decodes character entities. Block-level
+// tags become a space so the words on either side are not joined.
+type htmlStripCharFilter struct{}
+
+var (
+	htmlBlockTags = map[string]bool{
+		"address": true, "article": true, "aside": true, "blockquote": true, "br": true,
+		"dd": true, "div": true, "dl": true, "dt": true, "figcaption": true, "figure": true,
+		"footer": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+		"header": true, "hr": true, "li": true, "main": true, "nav": true, "ol": true,
+		"option": true, "p": true, "pre": true, "section": true, "table": true, "td": true,
+		"th": true, "title": true, "tr": true, "ul": true,
+	}
+	htmlSkippedTags = map[string]bool{"script": true, "style": true}
+)
+
+func newHTMLStripCharFilter(params json.RawMessage) (CharFilter, error) {
+	return htmlStripCharFilter{}, nil
+}
+
+func (f htmlStripCharFilter) Filter(text string) string {
+	text, _ = f.FilterOffsets(text)
+	return text
+}
+
+func (htmlStripCharFilter) FilterOffsets(text string) (string, *OffsetMap) {
+	var o offsetBuilder
+
+	for i := 0; i < len(text); {
+		next := strings.IndexAny(text[i:], "<&")
+		if next < 0 {
+			o.copy(text, i, len(text))
+			break
+		}
+
+		o.copy(text, i, i+next)
+		i += next
+
+		if text[i] == '&' {
+			end, decoded, ok := scanEntity(text, i)
+			if !ok {
+				o.copy(text, i, i+1)
+				i++
+				continue
+			}
+
+			o.replace(decoded, i, end)
+			i = end
+			continue
+		}
+
+		end, name, closing, ok := scanTag(text, i)
+		if !ok {
+			o.copy(text, i, i+1)
+			i++
+			continue
+		}
+
+		if htmlSkippedTags[name] && !closing {
+			end = skipElement(text, end, name)
+		}
+
+		if htmlBlockTags[name] {
+			o.replace(" ", i, end)
+		}
+
+		i = end
+	}
+
+	return o.result(text)
+}
+
+// scanTag reads the tag, comment or declaration starting at text[i], which
+// is '<'. It returns the offset just past it along with the lowercased tag
+// name and whether it is a closing tag.
+func scanTag(text string, i int) (int, string, bool, bool) {
+	rest := text[i:]
+
+	if strings.HasPrefix(rest, "<!--") {
+		end := strings.Index(rest[4:], "-->")
+		if end < 0 {
+			return len(text), "", false, true
+		}
+		return i + 4 + end + 3, "", false, true
+	}
+
+	if strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?") {
+		end := strings.IndexByte(rest, '>')
+		if end < 0 {
+			return 0, "", false, false
+		}
+		return i + end + 1, "", false, true
+	}
+
+	j := 1
+	closing := j < len(rest) && rest[j] == '/'
+	if closing {
+		j++
+	}
+
+	//a '<' not followed by a letter is text, as in "a < b"
+	nameStart := j
+	for j < len(rest) && (isASCIILetter(rest[j]) || (j > nameStart && rest[j] >= '0' && rest[j] <= '9')) {
+		j++
+	}
+	if j == nameStart {
+		return 0, "", false, false
+	}
+	name := strings.ToLower(rest[nameStart:j])
+
+	var quote byte
+	for ; j < len(rest); j++ {
+		switch c := rest[j]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i + j + 1, name, closing, true
+		}
+	}
+
+	return 0, "", false, false
+}
+
+// skipElement returns the offset just past the closing tag of the element
+// whose contents start at text[i].
+func skipElement(text string, i int, name string) int {
+	idx := strings.Index(strings.ToLower(text[i:]), "</"+name)
+	if idx < 0 {
+		return len(text)
+	}
+
+	end := strings.IndexByte(text[i+idx:], '>')
+	if end < 0 {
+		return len(text)
+	}
+
+	return i + idx + end + 1
+}
+
+// scanEntity decodes the character reference starting at text[i], which is
+// '&'.
+func scanEntity(text string, i int) (int, string, bool) {
+	//the longest named references are around 30 bytes long
+	rest := text[i:]
+	if len(rest) > 32 {
+		rest = rest[:32]
+	}
+
+	end := strings.IndexByte(rest, ';')
+	if end < 0 {
+		return 0, "", false
+	}
+
+	entity := rest[:end+1]
+	decoded := html.UnescapeString(entity)
+	if decoded == entity {
+		return 0, "", false
+	}
+
+	return i + end + 1, decoded, true
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// markdownStripCharFilter removes Markdown syntax: heading, quote and list
+// markers, emphasis and code markers, code fence lines, link destinations
+// and reference definitions. Link and image text is kept, as is the content
+// of code blocks.
+type markdownStripCharFilter struct{}
+
+var (
+	markdownFence     = regexp.MustCompile("^ {0,3}(```|~~~)")
+	markdownReference = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:\s*\S+`)
+	markdownRule      = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	markdownMarkers   = regexp.MustCompile(`^ {0,3}(?:(?:#{1,6}|>|[-*+]|\d{1,9}[.)])(?:[ \t]+|$))+`)
+)
+
+func newMarkdownStripCharFilter(params json.RawMessage) (CharFilter, error) {
+	return markdownStripCharFilter{}, nil
+}
+
+func (f markdownStripCharFilter) Filter(text string) string {
+	text, _ = f.FilterOffsets(text)
+	return text
+}
+
+func (f markdownStripCharFilter) FilterOffsets(text string) (string, *OffsetMap) {
+	var o offsetBuilder
+	inFence := false
+
+	for start := 0; start < len(text); {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+		}
+		line := strings.TrimRight(text[start:end], "\r")
+
+		switch {
+		case markdownFence.MatchString(line):
+			inFence = !inFence
+		case inFence:
+			o.copy(text, start, start+len(line))
+		case markdownReference.MatchString(line), markdownRule.MatchString(line):
+		default:
+			markers := markdownMarkers.FindStringIndex(line)
+			offset := 0
+			if markers != nil {
+				offset = markers[1]
+			}
+			f.inline(&o, text, start+offset, start+len(line))
+		}
+
+		if end < len(text) {
+			o.copy(text, end, end+1)
+		}
+		start = end + 1
+	}
+
+	return o.result(text)
+}
+
+// inline strips the inline syntax of text[start:end].
+func (f markdownStripCharFilter) inline(o *offsetBuilder, text string, start, end int) {
+	for i := start; i < end; {
+		switch c := text[i]; {
+		case c == '\\' && i+1 < end && strings.IndexByte("\\`*_{}[]()#+-.!~<>|", text[i+1]) >= 0:
+			o.copy(text, i+1, i+2)
+			i += 2
+		case c == '!' && i+1 < end && text[i+1] == '[':
+			if label, after, ok := scanLink(text, i+1, end); ok {
+				f.inline(o, text, i+2, label)
+				i = after
+				continue
+			}
+			o.copy(text, i, i+1)
+			i++
+		case c == '[':
+			if label, after, ok := scanLink(text, i, end); ok {
+				f.inline(o, text, i+1, label)
+				i = after
+				continue
+			}
+			o.copy(text, i, i+1)
+			i++
+		case c == '*' || c == '_' || c == '~' || c == '`':
+			//markers inside words, as in snake_case or 2*3, are kept
+			if isWordAt(text[:i], true) && isWordAt(text[i+1:end], false) {
+				o.copy(text, i, i+1)
+			}
+			i++
+		default:
+			o.copy(text, i, i+1)
+			i++
+		}
+	}
+}
+
+// scanLink reads an inline link or a reference link starting at text[i],
+// which is '['. It returns the offset of the ']' closing its text and the
+// offset just past the link.
+func scanLink(text string, i, end int) (int, int, bool) {
+	label := matchBracket(text, i, end, '[', ']')
+	if label < 0 || label+1 >= end {
+		return 0, 0, false
+	}
+
+	switch text[label+1] {
+	case '(':
+		if after := matchBracket(text, label+1, end, '(', ')'); after >= 0 {
+			return label, after + 1, true
+		}
+	case '[':
+		if after := matchBracket(text, label+1, end, '[', ']'); after >= 0 {
+			return label, after + 1, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+func matchBracket(text string, i, end int, open, close byte) int {
+	depth := 0
+	for j := i; j < end; j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// isWordAt reports whether the last rune of text, or its first rune when
+// last is false, is a letter or a digit.
+func isWordAt(text string, last bool) bool {
+	var r rune
+	if last {
+		r, _ = utf8.DecodeLastRuneInString(text)
+	} else {
+		r, _ = utf8.DecodeRuneInString(text)
+	}
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
@@ -0,0 +1,256 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ComponentConfig names a registered char filter, tokenizer or token filter
+// and holds its parameters. In JSON a component without parameters may be
+// written as just its type, e.g. "lowercase".
+type ComponentConfig struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+func (c *ComponentConfig) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		c.Type = name
+		c.Params = nil
+		return nil
+	}
+
+	type component ComponentConfig
+	var raw component
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	*c = ComponentConfig(raw)
+	return nil
+}
+
+// Config describes an analyzer chain, e.g.
+//
+//	{
+//	  "charFilters": [{"type": "mapping", "params": {"mappings": {"c++": "cpp"}}}],
+//	  "tokenizer": "standard",
+//	  "filters": ["lowercase", "stop", {"type": "stemmer", "params": {"language": "english"}}],
+//	  "language": "auto"
+//	}
+//
+// Language switches the language-aware filters to a language code, or to
+// the detected language of each text when set to "auto".
+type Config struct {
+	CharFilters []ComponentConfig `json:"charFilters,omitempty"`
+	Tokenizer   ComponentConfig   `json:"tokenizer"`
+	Filters     []ComponentConfig `json:"filters,omitempty"`
+	Language    string            `json:"language,omitempty"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Tokenizer: ComponentConfig{Type: "standard"},
+		Filters: []ComponentConfig{
+			{Type: "normalize"},
+			{Type: "lowercase"},
+			{Type: "synonym"},
+			{Type: "stop"},
+			{Type: "stemmer"},
+		},
+	}
+}
+
+// String returns c as compact JSON.
+func (c Config) String() string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		//invalid params cannot be marshalled, print them as is
+		type config Config
+		return fmt.Sprintf("%+v", config(c))
+	}
+	return string(b)
+}
+
+// Equal reports whether c and other describe the same analyzer chain,
+// whichever way their components were written.
+func (c Config) Equal(other Config) bool {
+	return c.String() == other.String()
+}
+
+// LoadConfig reads an analyzer config from a JSON file.
+func LoadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var config Config
+	err = json.Unmarshal(b, &config)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+type CharFilterFactory func(params json.RawMessage) (CharFilter, error)
+type TokenizerFactory func(params json.RawMessage) (Tokenizer, error)
+type TokenFilterFactory func(params json.RawMessage) (TokenFilter, error)
+
+var registry = struct {
+	mu          sync.RWMutex
+	charFilters map[string]CharFilterFactory
+	tokenizers  map[string]TokenizerFactory
+	filters     map[string]TokenFilterFactory
+}{
+	charFilters: map[string]CharFilterFactory{
+		"mapping":        newMappingCharFilter,
+		"html_strip":     newHTMLStripCharFilter,
+		"markdown_strip": newMarkdownStripCharFilter,
+	},
+	tokenizers: map[string]TokenizerFactory{
+		"standard":   newStandardTokenizer,
+		"whitespace": newWhitespaceTokenizer,
+		"keyword":    newKeywordTokenizer,
+	},
+	filters: map[string]TokenFilterFactory{
+		"lowercase":      newLowercaseFilter,
+		"normalize":      newNormalizeFilter,
+		"ascii_folding":  newASCIIFoldingFilter,
+		"stop":           newStopFilter,
+		"stemmer":        newStemmerFilter,
+		"length":         newLengthFilter,
+		"word_delimiter": newWordDelimiterFilter,
+		"synonym":        newSynonymFilter,
+	},
+}
+
+func RegisterCharFilter(name string, factory CharFilterFactory) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.charFilters[name] = factory
+}
+
+func RegisterTokenizer(name string, factory TokenizerFactory) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.tokenizers[name] = factory
+}
+
+func RegisterTokenFilter(name string, factory TokenFilterFactory) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.filters[name] = factory
+}
+
+// Registered lists the names of every registered component by kind.
+func Registered() map[string][]string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	names := map[string][]string{"charFilters": {}, "tokenizers": {}, "filters": {}}
+	for name := range registry.charFilters {
+		names["charFilters"] = append(names["charFilters"], name)
+	}
+	for name := range registry.tokenizers {
+		names["tokenizers"] = append(names["tokenizers"], name)
+	}
+	for name := range registry.filters {
+		names["filters"] = append(names["filters"], name)
+	}
+
+	for _, n := range names {
+		sort.Strings(n)
+	}
+
+	return names
+}
+
+// New builds an analyzer from config using the registered components.
+func New(config Config) (*Analyzer, error) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	a := &Analyzer{config: config}
+
+	for _, c := range config.CharFilters {
+		factory, ok := registry.charFilters[c.Type]
+		if !ok {
+			return nil, fmt.Errorf("analyzer: unknown char filter %q", c.Type)
+		}
+
+		f, err := factory(c.Params)
+		if err != nil {
+			return nil, fmt.Errorf("analyzer: char filter %q: %w", c.Type, err)
+		}
+		a.charFilters = append(a.charFilters, f)
+	}
+
+	tokenizerType := config.Tokenizer.Type
+	if tokenizerType == "" {
+		tokenizerType = "standard"
+	}
+
+	factory, ok := registry.tokenizers[tokenizerType]
+	if !ok {
+		return nil, fmt.Errorf("analyzer: unknown tokenizer %q", tokenizerType)
+	}
+
+	tokenizer, err := factory(config.Tokenizer.Params)
+	if err != nil {
+		return nil, fmt.Errorf("analyzer: tokenizer %q: %w", tokenizerType, err)
+	}
+	a.tokenizer = tokenizer
+
+	for _, c := range config.Filters {
+		factory, ok := registry.filters[c.Type]
+		if !ok {
+			return nil, fmt.Errorf("analyzer: unknown token filter %q", c.Type)
+		}
+
+		f, err := factory(c.Params)
+		if err != nil {
+			return nil, fmt.Errorf("analyzer: token filter %q: %w", c.Type, err)
+		}
+		a.filters = append(a.filters, f)
+	}
+
+	switch config.Language {
+	case "":
+	case AutoLanguage:
+		a.variants = map[string]*Analyzer{}
+		for _, code := range Languages() {
+			a.variants[code] = a.withLanguage(code)
+		}
+	default:
+		code, ok := languageCode(config.Language)
+		if !ok {
+			return nil, fmt.Errorf("analyzer: unsupported language %q", config.Language)
+		}
+		a = a.withLanguage(code)
+	}
+
+	return a, nil
+}
+
+func mustNew(config Config) *Analyzer {
+	a, err := New(config)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// decodeParams unmarshals the parameters of a component, leaving v untouched
+// when there are none.
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	return json.Unmarshal(params, v)
+}
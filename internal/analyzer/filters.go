@@ -0,0 +1,391 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+type lowercaseFilter struct{}
+
+func newLowercaseFilter(params json.RawMessage) (TokenFilter, error) {
+	return lowercaseFilter{}, nil
+}
+
+func (f lowercaseFilter) Filter(tokens []Token) []Token {
+	r := make([]Token, len(tokens))
+	for i, token := range tokens {
+		token.Term = f.Normalize(token.Term)
+		r[i] = token
+	}
+	return r
+}
+
+func (lowercaseFilter) Normalize(term string) string {
+	return strings.ToLower(term)
+}
+
+// normalizeFilter applies a Unicode normalization form, so composed and
+// decomposed spellings of a character, or compatibility variants such as
+// full-width letters and ligatures with NFKC, become the same term.
+type normalizeFilter struct {
+	form norm.Form
+	name string
+}
+
+var normalizationForms = map[string]norm.Form{
+	"nfc":  norm.NFC,
+	"nfd":  norm.NFD,
+	"nfkc": norm.NFKC,
+	"nfkd": norm.NFKD,
+}
+
+func newNormalizeFilter(params json.RawMessage) (TokenFilter, error) {
+	p := struct {
+		Form string `json:"form"`
+	}{Form: "nfc"}
+
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	name := strings.ToLower(p.Form)
+	form, ok := normalizationForms[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown normalization form %q", p.Form)
+	}
+
+	return normalizeFilter{form: form, name: name}, nil
+}
+
+func (f normalizeFilter) Filter(tokens []Token) []Token {
+	r := make([]Token, len(tokens))
+	for i, token := range tokens {
+		token.Term = f.Normalize(token.Term)
+		r[i] = token
+	}
+	return r
+}
+
+func (f normalizeFilter) Normalize(term string) string {
+	return f.form.String(term)
+}
+
+func (f normalizeFilter) Normalization() string {
+	return f.name
+}
+
+// asciiFoldingFilter removes diacritics and spells out letters without a
+// decomposition, e.g. "ß" as "ss", so "café" matches "cafe". The original
+// term can be kept at the same position to still favour exact spellings.
+type asciiFoldingFilter struct {
+	preserveOriginal bool
+}
+
+// foldings spells out the letters that do not decompose into a base letter
+// and combining marks.
+var foldings = map[rune]string{
+	'ß': "ss", 'ẞ': "SS", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE",
+	'ø': "o", 'Ø': "O", 'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D",
+	'ł': "l", 'Ł': "L", 'þ': "th", 'Þ': "TH", 'ı': "i", 'ŋ': "n", 'Ŋ': "N",
+}
+
+func newASCIIFoldingFilter(params json.RawMessage) (TokenFilter, error) {
+	p := struct {
+		PreserveOriginal bool `json:"preserveOriginal"`
+	}{}
+
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	return asciiFoldingFilter{preserveOriginal: p.PreserveOriginal}, nil
+}
+
+func (f asciiFoldingFilter) Filter(tokens []Token) []Token {
+	r := make([]Token, 0, len(tokens))
+	for _, token := range tokens {
+		folded := f.Normalize(token.Term)
+		if f.preserveOriginal && folded != token.Term {
+			r = append(r, token)
+		}
+
+		token.Term = folded
+		r = append(r, token)
+	}
+	return r
+}
+
+func (asciiFoldingFilter) Normalize(term string) string {
+	ascii := true
+	for i := 0; i < len(term); i++ {
+		if term[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return term
+	}
+
+	var b strings.Builder
+	for _, r := range norm.NFD.String(term) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if s, ok := foldings[r]; ok {
+			b.WriteString(s)
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return norm.NFC.String(b.String())
+}
+
+func (asciiFoldingFilter) Normalization() string {
+	return "ascii_folding"
+}
+
+// stopFilter drops stopwords: those of a language, English unless another is
+// given, or a custom list of words given inline or read from a file. The
+// list is held in a StopwordSet so it can be replaced or disabled at runtime.
+type stopFilter struct {
+	set    *StopwordSet
+	isStop func(word string) bool
+}
+
+func newStopFilter(params json.RawMessage) (TokenFilter, error) {
+	p := struct {
+		Words    []string `json:"words"`
+		Path     string   `json:"path"`
+		Language string   `json:"language"`
+		Disabled bool     `json:"disabled"`
+	}{Language: "en"}
+
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	if p.Path != "" {
+		words, err := LoadStopwords(p.Path)
+		if err != nil {
+			return nil, err
+		}
+		p.Words = append(p.Words, words...)
+	}
+
+	code, ok := languageCode(p.Language)
+	if !ok {
+		return nil, fmt.Errorf("no stopwords for language %q", p.Language)
+	}
+
+	set := NewStopwordSet(p.Words)
+	set.SetDisabled(p.Disabled)
+
+	return stopFilter{set: set, isStop: languages[code].isStop}, nil
+}
+
+func (f stopFilter) Filter(tokens []Token) []Token {
+	r := make([]Token, 0, len(tokens))
+	for _, token := range tokens {
+		if !f.set.isStop(token.Term, f.isStop) {
+			r = append(r, token)
+		}
+	}
+	return r
+}
+
+// ForLanguage switches to the stopwords of language. Custom stopwords, when
+// set, still take precedence.
+func (f stopFilter) ForLanguage(code string) TokenFilter {
+	return stopFilter{set: f.set, isStop: languages[code].isStop}
+}
+
+type stemmerFilter struct {
+	stem func(word string, stemStopWords bool) string
+}
+
+func newStemmerFilter(params json.RawMessage) (TokenFilter, error) {
+	p := struct {
+		Language string `json:"language"`
+	}{Language: "en"}
+
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	code, ok := languageCode(p.Language)
+	if !ok {
+		return nil, fmt.Errorf("no stemmer for language %q", p.Language)
+	}
+
+	return stemmerFilter{stem: languages[code].stem}, nil
+}
+
+func (f stemmerFilter) Filter(tokens []Token) []Token {
+	r := make([]Token, len(tokens))
+	for i, token := range tokens {
+		token.Term = f.Stem(token.Term)
+		r[i] = token
+	}
+	return r
+}
+
+func (f stemmerFilter) Stem(term string) string {
+	return f.stem(term, false)
+}
+
+func (f stemmerFilter) ForLanguage(code string) TokenFilter {
+	return stemmerFilter{stem: languages[code].stem}
+}
+
+// lengthFilter drops tokens shorter than min or longer than max runes. A max
+// of 0 means no upper bound.
+type lengthFilter struct {
+	min int
+	max int
+}
+
+func newLengthFilter(params json.RawMessage) (TokenFilter, error) {
+	var p struct {
+		Min int `json:"min"`
+		Max int `json:"max"`
+	}
+
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	return lengthFilter{min: p.Min, max: p.Max}, nil
+}
+
+func (f lengthFilter) Filter(tokens []Token) []Token {
+	r := make([]Token, 0, len(tokens))
+	for _, token := range tokens {
+		n := utf8.RuneCountInString(token.Term)
+		if n < f.min || (f.max > 0 && n > f.max) {
+			continue
+		}
+		r = append(r, token)
+	}
+	return r
+}
+
+// wordDelimiterFilter splits identifiers on case changes and letter-digit
+// transitions, so "parseHTTPResponse2" yields "parse", "HTTP", "Response"
+// and "2". It suits code search, where identifiers are rarely typed whole.
+type wordDelimiterFilter struct {
+	preserveOriginal bool
+}
+
+func newWordDelimiterFilter(params json.RawMessage) (TokenFilter, error) {
+	var p struct {
+		PreserveOriginal bool `json:"preserveOriginal"`
+	}
+
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	return wordDelimiterFilter{preserveOriginal: p.PreserveOriginal}, nil
+}
+
+func (f wordDelimiterFilter) Filter(tokens []Token) []Token {
+	return f.FilterText("", tokens)
+}
+
+// FilterText splits tokens like Filter, reading the offsets of every part
+// from text rather than from the term, which earlier filters may have
+// rewritten.
+func (f wordDelimiterFilter) FilterText(text string, tokens []Token) []Token {
+	r := make([]Token, 0, len(tokens))
+	shift := 0
+
+	for _, token := range tokens {
+		parts := splitWord(token.Term)
+		position := token.Position + shift
+
+		if f.preserveOriginal && len(parts) > 1 {
+			r = append(r, Token{Term: token.Term, Position: position, Start: token.Start, End: token.End})
+		}
+
+		offsets := partOffsets(text, token, parts)
+		for j, part := range parts {
+			r = append(r, Token{Term: part, Position: position + j, Start: offsets[j][0], End: offsets[j][1]})
+		}
+
+		shift += len(parts) - 1
+	}
+
+	return r
+}
+
+// partOffsets returns the byte range of every part of token in text. Parts
+// are located by their rune positions in the term, which match the text as
+// long as earlier filters kept one rune per rune, e.g. folding é to e. When
+// they did not, e.g. folding ß to ss, every part spans the whole token.
+func partOffsets(text string, token Token, parts []string) [][2]int {
+	source := token.Term
+	if token.Start >= 0 && token.Start <= token.End && token.End <= len(text) {
+		source = text[token.Start:token.End]
+	}
+
+	offsets := make([][2]int, len(parts))
+
+	if utf8.RuneCountInString(source) != utf8.RuneCountInString(token.Term) {
+		for j := range parts {
+			offsets[j] = [2]int{token.Start, token.End}
+		}
+		return offsets
+	}
+
+	start := token.Start
+	for j, part := range parts {
+		end := start
+		for n := utf8.RuneCountInString(part); n > 0; n-- {
+			_, size := utf8.DecodeRuneInString(source[end-token.Start:])
+			end += size
+		}
+		offsets[j] = [2]int{start, end}
+		start = end
+	}
+
+	return offsets
+}
+
+func splitWord(word string) []string {
+	runes := []rune(word)
+	if len(runes) == 0 {
+		return []string{word}
+	}
+
+	parts := []string{}
+	start := 0
+
+	for i := 1; i < len(runes); i++ {
+		prev, curr := runes[i-1], runes[i]
+
+		split := false
+		switch {
+		case unicode.IsLower(prev) && unicode.IsUpper(curr):
+			split = true
+		case isLetter(prev) != isLetter(curr):
+			split = true
+		case unicode.IsUpper(prev) && unicode.IsUpper(curr) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+			//the last capital of an acronym starts the next word
+			split = true
+		}
+
+		if split {
+			parts = append(parts, string(runes[start:i]))
+			start = i
+		}
+	}
+
+	return append(parts, string(runes[start:]))
+}
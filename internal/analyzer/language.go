@@ -0,0 +1,180 @@
+package analyzer
+
+import (
+	"embed"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	snowballeng "github.com/kljensen/snowball/english"
+	snowballfr "github.com/kljensen/snowball/french"
+	snowballhu "github.com/kljensen/snowball/hungarian"
+	snowballno "github.com/kljensen/snowball/norwegian"
+	snowballru "github.com/kljensen/snowball/russian"
+	snowballes "github.com/kljensen/snowball/spanish"
+	snowballsv "github.com/kljensen/snowball/swedish"
+)
+
+// Language identification by n-gram profiles, as described in Cavnar &
+// Trenkle, "N-Gram-Based Text Categorization". Profiles are built at start-up
+// from the sample texts in languages/, so detection works offline.
+
+const (
+	// AutoLanguage makes an analyzer detect the language of every text it
+	// analyzes.
+	AutoLanguage = "auto"
+
+	profileSize = 300
+	maxNGram    = 5
+)
+
+type language struct {
+	stem   func(word string, stemStopWords bool) string
+	isStop func(word string) bool
+}
+
+// languages are those with a snowball stemmer, keyed by ISO 639-1 code.
+var languages = map[string]language{
+	"en": {stem: snowballeng.Stem, isStop: func(word string) bool { _, ok := english[word]; return ok }},
+	"fr": {stem: snowballfr.Stem, isStop: snowballfr.IsStopWord},
+	"es": {stem: snowballes.Stem, isStop: snowballes.IsStopWord},
+	"ru": {stem: snowballru.Stem, isStop: snowballru.IsStopWord},
+	"sv": {stem: snowballsv.Stem, isStop: snowballsv.IsStopWord},
+	"no": {stem: snowballno.Stem, isStop: snowballno.IsStopWord},
+	"hu": {stem: snowballhu.Stem, isStop: snowballhu.IsStopWord},
+}
+
+var languageNames = map[string]string{
+	"english":   "en",
+	"french":    "fr",
+	"spanish":   "es",
+	"russian":   "ru",
+	"swedish":   "sv",
+	"norwegian": "no",
+	"hungarian": "hu",
+}
+
+// languageCode resolves a language name or code to a supported code.
+func languageCode(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if code, ok := languageNames[name]; ok {
+		return code, true
+	}
+
+	_, ok := languages[name]
+	return name, ok
+}
+
+// Languages lists the codes of every supported language.
+func Languages() []string {
+	codes := make([]string, 0, len(languages))
+	for code := range languages {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+//go:embed languages/*.txt
+var samples embed.FS
+
+var profiles = buildProfiles()
+
+func buildProfiles() map[string]map[string]int {
+	entries, err := samples.ReadDir("languages")
+	if err != nil {
+		panic(err)
+	}
+
+	p := map[string]map[string]int{}
+	for _, entry := range entries {
+		b, err := samples.ReadFile(path.Join("languages", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+
+		code := strings.TrimSuffix(entry.Name(), ".txt")
+		p[code] = profile(string(b))
+	}
+
+	return p
+}
+
+// DetectLanguage returns the code of the supported language whose profile is
+// closest to that of text. English is assumed for text without letters.
+func DetectLanguage(text string) string {
+	textProfile := profile(text)
+	if len(textProfile) == 0 {
+		return "en"
+	}
+
+	best, bestDistance := "en", -1
+	for _, code := range Languages() {
+		languageProfile := profiles[code]
+
+		//out-of-place measure: how far each n-gram moved between the profiles
+		distance := 0
+		for ngram, rank := range textProfile {
+			if r, ok := languageProfile[ngram]; ok {
+				distance += abs(rank - r)
+			} else {
+				distance += profileSize
+			}
+		}
+
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = code, distance
+		}
+	}
+
+	return best
+}
+
+// profile ranks the most frequent 1 to 5-grams of the words of text.
+func profile(text string) map[string]int {
+	counts := map[string]int{}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	for _, word := range words {
+		runes := []rune("_" + word + "_")
+		for n := 1; n <= maxNGram; n++ {
+			for i := 0; i+n <= len(runes); i++ {
+				counts[string(runes[i:i+n])]++
+			}
+		}
+	}
+
+	ngrams := make([]string, 0, len(counts))
+	for ngram := range counts {
+		ngrams = append(ngrams, ngram)
+	}
+
+	sort.Slice(ngrams, func(i, j int) bool {
+		if counts[ngrams[i]] != counts[ngrams[j]] {
+			return counts[ngrams[i]] > counts[ngrams[j]]
+		}
+		return ngrams[i] < ngrams[j]
+	})
+
+	if len(ngrams) > profileSize {
+		ngrams = ngrams[:profileSize]
+	}
+
+	ranks := make(map[string]int, len(ngrams))
+	for rank, ngram := range ngrams {
+		ranks[ngram] = rank
+	}
+
+	return ranks
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
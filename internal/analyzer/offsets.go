@@ -0,0 +1,85 @@
+package analyzer
+
+import "strings"
+
+// OffsetMap maps byte offsets in the output of a char filter back to its
+// input. Every output byte records the range of input bytes it was produced
+// from, so a decoded entity maps back to the whole entity.
+type OffsetMap struct {
+	starts []int
+	ends   []int
+	length int
+}
+
+// Start maps the offset at which a token starts.
+func (m *OffsetMap) Start(offset int) int {
+	if m == nil {
+		return offset
+	}
+	if offset >= len(m.starts) {
+		return m.length
+	}
+	return m.starts[offset]
+}
+
+// End maps the offset just past the last byte of a token.
+func (m *OffsetMap) End(offset int) int {
+	if m == nil {
+		return offset
+	}
+	if offset <= 0 {
+		return m.Start(0)
+	}
+	if offset > len(m.ends) {
+		return m.length
+	}
+	return m.ends[offset-1]
+}
+
+// then returns the map of next applied to the output of m.
+func (m *OffsetMap) then(next *OffsetMap) *OffsetMap {
+	if m == nil {
+		return next
+	}
+	if next == nil {
+		return m
+	}
+
+	c := &OffsetMap{starts: make([]int, len(next.starts)), ends: make([]int, len(next.ends)), length: m.length}
+	for i := range next.starts {
+		c.starts[i] = m.Start(next.starts[i])
+		c.ends[i] = m.End(next.ends[i])
+	}
+
+	return c
+}
+
+// offsetBuilder builds the output of a char filter along with its offset
+// map. Input that is neither copied nor replaced is dropped.
+type offsetBuilder struct {
+	text   strings.Builder
+	starts []int
+	ends   []int
+}
+
+// copy appends input[start:end] unchanged.
+func (o *offsetBuilder) copy(input string, start, end int) {
+	for i := start; i < end; i++ {
+		o.starts = append(o.starts, i)
+		o.ends = append(o.ends, i+1)
+	}
+	o.text.WriteString(input[start:end])
+}
+
+// replace appends s in place of the input bytes from start to end.
+func (o *offsetBuilder) replace(s string, start, end int) {
+	for i := 0; i < len(s); i++ {
+		o.starts = append(o.starts, start)
+		o.ends = append(o.ends, end)
+	}
+	o.text.WriteString(s)
+}
+
+func (o *offsetBuilder) result(input string) (string, *OffsetMap) {
+	return o.text.String(), &OffsetMap{starts: o.starts, ends: o.ends, length: len(input)}
+}
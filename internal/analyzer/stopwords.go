@@ -0,0 +1,141 @@
+package analyzer
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultStopwords is the fingerprint of a set using the stopwords of
+	// the analyzed language.
+	DefaultStopwords = "default"
+	// DisabledStopwords is the fingerprint of a set that drops no words.
+	DisabledStopwords = "disabled"
+	// NoStopwords is the fingerprint of an analyzer without a stop filter.
+	NoStopwords = "none"
+)
+
+// StopwordSet holds the stopwords of a stop filter. Until custom words are
+// set the stopwords of the analyzed language are used. A set can be replaced
+// or disabled while it is in use.
+type StopwordSet struct {
+	mu       sync.RWMutex
+	words    map[string]bool
+	custom   bool
+	disabled bool
+}
+
+// NewStopwordSet returns a set of custom stopwords, or a set using the
+// stopwords of the analyzed language if words is nil.
+func NewStopwordSet(words []string) *StopwordSet {
+	s := &StopwordSet{}
+	s.Set(words)
+	return s
+}
+
+// Set replaces the custom stopwords. A nil list goes back to the stopwords
+// of the analyzed language.
+func (s *StopwordSet) Set(words []string) {
+	set := map[string]bool{}
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			set[w] = true
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.words = set
+	s.custom = words != nil
+}
+
+func (s *StopwordSet) SetDisabled(disabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disabled = disabled
+}
+
+// Words returns the sorted custom stopwords, or nil if the set uses the
+// stopwords of the analyzed language.
+func (s *StopwordSet) Words() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.custom {
+		return nil
+	}
+
+	words := make([]string, 0, len(s.words))
+	for w := range s.words {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+
+	return words
+}
+
+func (s *StopwordSet) Disabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.disabled
+}
+
+// Fingerprint identifies the stopwords of the set, so segments built with
+// different stopwords can be told apart.
+func (s *StopwordSet) Fingerprint() string {
+	if s.Disabled() {
+		return DisabledStopwords
+	}
+
+	words := s.Words()
+	if words == nil {
+		return DefaultStopwords
+	}
+
+	hash := sha256.Sum256([]byte(strings.Join(words, "\n")))
+	return hex.EncodeToString(hash[:8])
+}
+
+// isStop reports whether word is a stopword, falling back to language when
+// the set has no custom words.
+func (s *StopwordSet) isStop(word string, language func(string) bool) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	switch {
+	case s.disabled:
+		return false
+	case s.custom:
+		return s.words[word]
+	default:
+		return language(word)
+	}
+}
+
+// LoadStopwords reads a stopword list with one word per line. Blank lines
+// and lines starting with '#' are ignored.
+func LoadStopwords(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	words := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+
+	return words, scanner.Err()
+}
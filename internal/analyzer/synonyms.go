@@ -0,0 +1,266 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxSynonymVariants caps the number of token sequences a query expands
+	// to, since every matched rule multiplies them.
+	maxSynonymVariants = 16
+)
+
+// SynonymSet holds synonym rules in the Solr format, one rule per line:
+//
+//	k8s, kubernetes        equivalent: every term expands to the whole group
+//	nyc, ny => new york    one-way: the left side is replaced by the right side
+//
+// Either side may hold multi-word synonyms. Rules are matched against
+// lowercased words, so the synonym filter belongs after the lowercase filter.
+// A set can be replaced while it is in use.
+type SynonymSet struct {
+	mu       sync.RWMutex
+	rules    []string
+	mappings map[string][][]string
+	maxWords int
+}
+
+func NewSynonymSet(rules []string) (*SynonymSet, error) {
+	s := &SynonymSet{}
+	if err := s.Set(rules); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SynonymSet) Rules() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string{}, s.rules...)
+}
+
+// Set replaces every rule of the set. The set is left unchanged if any rule
+// is invalid.
+func (s *SynonymSet) Set(rules []string) error {
+	mappings := map[string][][]string{}
+	maxWords := 0
+
+	add := func(from []string, to [][]string) {
+		key := strings.Join(from, " ")
+		for _, words := range to {
+			if !containsWords(mappings[key], words) {
+				mappings[key] = append(mappings[key], words)
+			}
+		}
+		if len(from) > maxWords {
+			maxWords = len(from)
+		}
+	}
+
+	for _, rule := range rules {
+		if strings.TrimSpace(rule) == "" || strings.HasPrefix(strings.TrimSpace(rule), "#") {
+			continue
+		}
+
+		sides := strings.Split(rule, "=>")
+		if len(sides) > 2 {
+			return fmt.Errorf("analyzer: synonym rule %q has more than one =>", rule)
+		}
+
+		left, err := parseSynonyms(sides[0])
+		if err != nil {
+			return fmt.Errorf("analyzer: synonym rule %q: %w", rule, err)
+		}
+
+		if len(sides) == 1 {
+			for _, from := range left {
+				add(from, left)
+			}
+			continue
+		}
+
+		right, err := parseSynonyms(sides[1])
+		if err != nil {
+			return fmt.Errorf("analyzer: synonym rule %q: %w", rule, err)
+		}
+
+		for _, from := range left {
+			add(from, right)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules = append([]string{}, rules...)
+	s.mappings = mappings
+	s.maxWords = maxWords
+
+	return nil
+}
+
+// parseSynonyms splits a comma separated side of a rule into its synonyms,
+// each made of one or more lowercased words.
+func parseSynonyms(side string) ([][]string, error) {
+	synonyms := [][]string{}
+
+	for _, synonym := range strings.Split(side, ",") {
+		words := terms(standardTokenizer{}.Tokenize(strings.ToLower(synonym)))
+		if len(words) == 0 {
+			return nil, fmt.Errorf("empty synonym")
+		}
+		synonyms = append(synonyms, words)
+	}
+
+	return synonyms, nil
+}
+
+func containsWords(synonyms [][]string, words []string) bool {
+	for _, synonym := range synonyms {
+		if strings.Join(synonym, " ") == strings.Join(words, " ") {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the number of tokens of the longest rule starting at
+// tokens[i] and the synonyms they map to, or 0 if no rule applies.
+func (s *SynonymSet) match(tokens []Token) (int, [][]string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for n := min(s.maxWords, len(tokens)); n > 0; n-- {
+		if synonyms, ok := s.mappings[strings.Join(terms(tokens[:n]), " ")]; ok {
+			return n, synonyms
+		}
+	}
+
+	return 0, nil
+}
+
+// synonymFilter expands terms to their synonyms. Queries are always
+// expanded into alternative token sequences, so multi-word synonyms keep
+// correct positions for phrase queries. Documents are only expanded when the
+// filter applies at index time: synonyms are then stacked at the position of
+// the words they replace.
+type synonymFilter struct {
+	set       *SynonymSet
+	indexTime bool
+}
+
+func newSynonymFilter(params json.RawMessage) (TokenFilter, error) {
+	p := struct {
+		Rules     []string `json:"rules"`
+		IndexTime bool     `json:"indexTime"`
+	}{}
+
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	set, err := NewSynonymSet(p.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &synonymFilter{set: set, indexTime: p.IndexTime}, nil
+}
+
+func (f *synonymFilter) Filter(tokens []Token) []Token {
+	if !f.indexTime {
+		return tokens
+	}
+
+	r := make([]Token, 0, len(tokens))
+	for i := 0; i < len(tokens); {
+		n, synonyms := f.set.match(tokens[i:])
+		if n == 0 {
+			r = append(r, tokens[i])
+			i++
+			continue
+		}
+
+		for _, words := range synonyms {
+			r = append(r, replace(tokens[i:i+n], words)...)
+		}
+		i += n
+	}
+
+	return r
+}
+
+// Variants expands tokens into every sequence obtained by replacing the
+// words matched by a rule with one of their synonyms. Tokens following a
+// multi-word synonym are shifted so positions stay contiguous.
+func (f *synonymFilter) Variants(tokens []Token) [][]Token {
+	variants := [][]Token{{}}
+	shifts := []int{0}
+
+	for i := 0; i < len(tokens); {
+		n, synonyms := f.set.match(tokens[i:])
+		if n == 0 {
+			for v := range variants {
+				token := tokens[i]
+				token.Position += shifts[v]
+				variants[v] = append(variants[v], token)
+			}
+			i++
+			continue
+		}
+
+		matched := tokens[i : i+n]
+		length := matched[n-1].Position - matched[0].Position + 1
+
+		expanded, expandedShifts := [][]Token{}, []int{}
+		for v, variant := range variants {
+			for _, words := range synonyms {
+				if len(expanded) == maxSynonymVariants {
+					break
+				}
+
+				next := append([]Token{}, variant...)
+				for _, token := range replace(matched, words) {
+					token.Position += shifts[v]
+					next = append(next, token)
+				}
+
+				expanded = append(expanded, next)
+				expandedShifts = append(expandedShifts, shifts[v]+len(words)-length)
+			}
+		}
+
+		variants, shifts = expanded, expandedShifts
+		i += n
+	}
+
+	return variants
+}
+
+// replace returns the tokens of words standing in for matched. The matched
+// tokens themselves are returned when words is one of the synonyms of a rule
+// applying to them.
+func replace(matched []Token, words []string) []Token {
+	if strings.Join(terms(matched), " ") == strings.Join(words, " ") {
+		return matched
+	}
+
+	first, last := matched[0], matched[len(matched)-1]
+
+	r := make([]Token, len(words))
+	for j, word := range words {
+		r[j] = Token{Term: word, Position: first.Position + j, Start: first.Start, End: last.End}
+	}
+
+	return r
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
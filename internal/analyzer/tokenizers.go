@@ -0,0 +1,138 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// standardTokenizer splits on any character that is not a letter or a number.
+// Chinese, Japanese and Korean are written without spaces between words, so
+// runs of CJK characters are instead emitted as overlapping bigrams: a query
+// for a word then matches the bigrams it is made of at adjacent positions.
+type standardTokenizer struct{}
+
+func newStandardTokenizer(params json.RawMessage) (Tokenizer, error) {
+	return standardTokenizer{}, nil
+}
+
+func (standardTokenizer) Tokenize(text string) []Token {
+	tokens := []Token{}
+	wordStart := -1
+	run := []int{}
+
+	emit := func(start, end int) {
+		tokens = append(tokens, Token{Term: text[start:end], Position: len(tokens), Start: start, End: end})
+	}
+
+	flushWord := func(end int) {
+		if wordStart >= 0 {
+			emit(wordStart, end)
+			wordStart = -1
+		}
+	}
+
+	//run holds the byte offset of every character of the CJK run plus the
+	//offset just past its last one
+	flushRun := func() {
+		switch {
+		case len(run) == 2:
+			emit(run[0], run[1])
+		case len(run) > 2:
+			for i := 0; i+2 < len(run); i++ {
+				emit(run[i], run[i+2])
+			}
+		}
+		run = run[:0]
+	}
+
+	for offset, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord(offset)
+			if len(run) == 0 {
+				run = append(run, offset)
+			}
+			run = append(run, offset+utf8.RuneLen(r))
+		case isLetter(r) || unicode.IsNumber(r):
+			flushRun()
+			if wordStart < 0 {
+				wordStart = offset
+			}
+		default:
+			flushWord(offset)
+			flushRun()
+		}
+	}
+
+	flushWord(len(text))
+	flushRun()
+
+	return tokens
+}
+
+// isLetter reports whether r is a letter or a combining mark, so decomposed
+// characters such as "e\u0301" stay within their word.
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r)
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) ||
+		//the prolonged sound mark is shared by hiragana and katakana
+		r == 'ー'
+}
+
+// whitespaceTokenizer splits on whitespace only, keeping punctuation such as
+// the dots and dashes of identifiers and part numbers.
+type whitespaceTokenizer struct{}
+
+func newWhitespaceTokenizer(params json.RawMessage) (Tokenizer, error) {
+	return whitespaceTokenizer{}, nil
+}
+
+func (whitespaceTokenizer) Tokenize(text string) []Token {
+	tokens := []Token{}
+	start := -1
+
+	for offset, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				tokens = append(tokens, Token{Term: text[start:offset], Position: len(tokens), Start: start, End: offset})
+				start = -1
+			}
+			continue
+		}
+
+		if start < 0 {
+			start = offset
+		}
+	}
+
+	if start >= 0 {
+		tokens = append(tokens, Token{Term: text[start:], Position: len(tokens), Start: start, End: len(text)})
+	}
+
+	return tokens
+}
+
+// keywordTokenizer emits the whole text as a single token.
+type keywordTokenizer struct{}
+
+func newKeywordTokenizer(params json.RawMessage) (Tokenizer, error) {
+	return keywordTokenizer{}, nil
+}
+
+func (keywordTokenizer) Tokenize(text string) []Token {
+	term := strings.TrimSpace(text)
+	if term == "" {
+		return []Token{}
+	}
+
+	start := strings.Index(text, term)
+	return []Token{{Term: term, Position: 0, Start: start, End: start + len(term)}}
+}
@@ -0,0 +1,214 @@
+package chunking
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// TokensStrategy cuts documents into consecutive chunks of Size words.
+	TokensStrategy = "tokens"
+	// SentencesStrategy packs whole sentences into chunks of at most Size
+	// words, only cutting sentences longer than that.
+	SentencesStrategy = "sentences"
+	// WindowStrategy slides a window of Size words over documents, each
+	// chunk sharing Overlap words with the previous one.
+	WindowStrategy = "window"
+
+	// DefaultSize keeps chunks well below the 512 word pieces the sentence
+	// transformer of third_party reads.
+	DefaultSize    = 200
+	DefaultOverlap = 40
+)
+
+// Chunk is a passage of a document, Text being document[Start:End].
+type Chunk struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// Chunker cuts a document into the passages embedded separately. Documents
+// without words have no chunks.
+type Chunker interface {
+	Chunk(document string) []Chunk
+}
+
+// Config selects and configures a chunker.
+type Config struct {
+	// Strategy is one of tokens, sentences or window.
+	Strategy string
+	// Size is the maximum number of words of a chunk.
+	Size int
+	// Overlap is the number of words shared by consecutive windows.
+	Overlap int
+}
+
+// New returns the chunker described by config, nil when config has no
+// strategy, in which case documents are embedded whole.
+func New(config Config) (Chunker, error) {
+	if config.Size <= 0 {
+		config.Size = DefaultSize
+	}
+
+	switch config.Strategy {
+	case "":
+		return nil, nil
+	case TokensStrategy:
+		return NewTokens(config.Size), nil
+	case SentencesStrategy:
+		return NewSentences(config.Size), nil
+	case WindowStrategy:
+		if config.Overlap < 0 || config.Overlap >= config.Size {
+			return nil, fmt.Errorf("chunking: overlap %d must be between 0 and the chunk size %d", config.Overlap, config.Size)
+		}
+		return NewWindow(config.Size, config.Overlap), nil
+	default:
+		return nil, fmt.Errorf("chunking: unknown strategy %q", config.Strategy)
+	}
+}
+
+// Window cuts documents into chunks of Size words, consecutive chunks
+// sharing Overlap words.
+type Window struct {
+	Size    int
+	Overlap int
+}
+
+func NewWindow(size, overlap int) *Window {
+	return &Window{Size: size, Overlap: overlap}
+}
+
+// NewTokens returns a window without overlap.
+func NewTokens(size int) *Window {
+	return NewWindow(size, 0)
+}
+
+func (w *Window) Chunk(document string) []Chunk {
+	return window(document, words(document, 0, len(document)), w.Size, w.Overlap)
+}
+
+func window(document string, spans []span, size, overlap int) []Chunk {
+	chunks := []Chunk{}
+
+	for start := 0; start < len(spans); start += size - overlap {
+		end := start + size
+		if end > len(spans) {
+			end = len(spans)
+		}
+		chunks = append(chunks, newChunk(document, spans[start].start, spans[end-1].end))
+
+		if end == len(spans) {
+			break
+		}
+	}
+
+	return chunks
+}
+
+// Sentences packs consecutive sentences into chunks of at most Size words.
+type Sentences struct {
+	Size int
+}
+
+func NewSentences(size int) *Sentences {
+	return &Sentences{Size: size}
+}
+
+func (s *Sentences) Chunk(document string) []Chunk {
+	chunks := []Chunk{}
+	current, count := span{}, 0
+
+	for _, sentence := range sentences(document) {
+		spans := words(document, sentence.start, sentence.end)
+		if len(spans) == 0 {
+			continue
+		}
+
+		if count > 0 && count+len(spans) > s.Size {
+			chunks = append(chunks, newChunk(document, current.start, current.end))
+			count = 0
+		}
+
+		//a sentence too long for any chunk is cut like tokens
+		if len(spans) > s.Size {
+			chunks = append(chunks, window(document, spans, s.Size, 0)...)
+			continue
+		}
+
+		if count == 0 {
+			current.start = spans[0].start
+		}
+		current.end = spans[len(spans)-1].end
+		count += len(spans)
+	}
+
+	if count > 0 {
+		chunks = append(chunks, newChunk(document, current.start, current.end))
+	}
+
+	return chunks
+}
+
+func newChunk(document string, start, end int) Chunk {
+	return Chunk{Text: document[start:end], Start: start, End: end}
+}
+
+// span is a byte range of a document.
+type span struct {
+	start int
+	end   int
+}
+
+// words returns the spans of the whitespace separated words of
+// document[start:end].
+func words(document string, start, end int) []span {
+	spans := []span{}
+	inWord := false
+
+	for i, r := range document[start:end] {
+		if unicode.IsSpace(r) {
+			if inWord {
+				spans[len(spans)-1].end = start + i
+				inWord = false
+			}
+			continue
+		}
+
+		if !inWord {
+			spans = append(spans, span{start: start + i, end: end})
+			inWord = true
+		}
+	}
+
+	return spans
+}
+
+// sentences returns the spans of the sentences of document. A sentence ends
+// after ., ! or ? followed by whitespace, or at a blank line.
+func sentences(document string) []span {
+	spans := []span{}
+	start := 0
+
+	for i, r := range document {
+		next, size := utf8.DecodeRuneInString(document[i+utf8.RuneLen(r):])
+		end := i + utf8.RuneLen(r)
+
+		switch {
+		case (r == '.' || r == '!' || r == '?') && (size == 0 || unicode.IsSpace(next)):
+		case r == '\n' && next == '\n':
+		default:
+			continue
+		}
+
+		spans = append(spans, span{start: start, end: end})
+		start = end
+	}
+
+	if start < len(document) {
+		spans = append(spans, span{start: start, end: len(document)})
+	}
+
+	return spans
+}
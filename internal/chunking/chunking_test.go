@@ -0,0 +1,65 @@
+package chunking
+
+import (
+	"reflect"
+	"testing"
+)
+
+func texts(chunks []Chunk) []string {
+	r := []string{}
+	for _, c := range chunks {
+		r = append(r, c.Text)
+	}
+	return r
+}
+
+func TestTokens(t *testing.T) {
+	document := "one two  three four\nfive"
+
+	got := NewTokens(2).Chunk(document)
+	expected := []string{"one two", "three four", "five"}
+
+	if !reflect.DeepEqual(texts(got), expected) {
+		t.Fatalf("expected %v, got %v", expected, texts(got))
+	}
+
+	for _, c := range got {
+		if document[c.Start:c.End] != c.Text {
+			t.Fatalf("expected span %v to hold %q", c, c.Text)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	got := NewWindow(3, 1).Chunk("a b c d e f g")
+	expected := []string{"a b c", "c d e", "e f g"}
+
+	if !reflect.DeepEqual(texts(got), expected) {
+		t.Fatalf("expected %v, got %v", expected, texts(got))
+	}
+}
+
+func TestSentences(t *testing.T) {
+	document := "Batman saves Gotham. The Joker laughs! Who is next?\n\nAlfred serves tea with a very long sentence indeed"
+
+	got := NewSentences(6).Chunk(document)
+	expected := []string{"Batman saves Gotham. The Joker laughs!", "Who is next?", "Alfred serves tea with a very", "long sentence indeed"}
+
+	if !reflect.DeepEqual(texts(got), expected) {
+		t.Fatalf("expected %v, got %v", expected, texts(got))
+	}
+}
+
+func TestNew(t *testing.T) {
+	if c, err := New(Config{}); c != nil || err != nil {
+		t.Fatalf("expected no chunker, got %v, %v", c, err)
+	}
+
+	if _, err := New(Config{Strategy: WindowStrategy, Size: 4, Overlap: 4}); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if len(NewTokens(5).Chunk(" \n ")) != 0 {
+		t.Fatalf("expected no chunks")
+	}
+}
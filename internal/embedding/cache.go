@@ -0,0 +1,220 @@
+package embedding
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// CacheBucket is the bbolt bucket persisted vectors are stored in.
+const CacheBucket = "embeddings"
+
+// Cache is an Embedder remembering the vectors of the most recently embedded
+// texts, so repeated queries and re-indexed documents skip the wrapped
+// embedder. Texts are keyed by the hash of their content and of a namespace
+// identifying the embedder, so vectors of another model are never returned.
+// When a bbolt database is given every vector is also persisted there and
+// survives restarts; only the in-memory part is bounded.
+type Cache struct {
+	embedder  Embedder
+	size      int
+	namespace string
+	store     *bolt.DB
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	recent  *list.List
+}
+
+type cacheEntry struct {
+	key    [sha256.Size]byte
+	vector []float64
+}
+
+// NewCache caches up to size vectors of embedder in memory. store may be nil
+// to keep the cache in memory only.
+func NewCache(embedder Embedder, size int, store *bolt.DB, namespace string) (*Cache, error) {
+	if store != nil {
+		err := store.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(CacheBucket))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Cache{
+		embedder:  embedder,
+		size:      size,
+		namespace: namespace,
+		store:     store,
+		entries:   map[[sha256.Size]byte]*list.Element{},
+		recent:    list.New(),
+	}, nil
+}
+
+func (c *Cache) Embed(ctx context.Context, text string) ([]float64, error) {
+	key := c.key(text)
+	if vector, ok := c.get(key); ok {
+		return vector, nil
+	}
+
+	vector, err := c.embedder.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	c.put([][sha256.Size]byte{key}, [][]float64{vector})
+
+	return vector, nil
+}
+
+// EmbedBatch only sends the texts missing from the cache to the wrapped
+// embedder.
+func (c *Cache) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	keys := make([][sha256.Size]byte, len(texts))
+
+	missing, missingTexts := []int{}, []string{}
+	for i, text := range texts {
+		keys[i] = c.key(text)
+		if vector, ok := c.get(keys[i]); ok {
+			vectors[i] = vector
+			continue
+		}
+		missing = append(missing, i)
+		missingTexts = append(missingTexts, text)
+	}
+
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+
+	embedded, err := c.embedder.EmbedBatch(ctx, missingTexts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkBatch(missingTexts, embedded); err != nil {
+		return nil, err
+	}
+
+	missingKeys := make([][sha256.Size]byte, len(missing))
+	for j, i := range missing {
+		vectors[i] = embedded[j]
+		missingKeys[j] = keys[i]
+	}
+	c.put(missingKeys, embedded)
+
+	return vectors, nil
+}
+
+// Len returns the number of vectors cached in memory.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.recent.Len()
+}
+
+func (c *Cache) key(text string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(c.namespace + "\x00" + text))
+}
+
+func (c *Cache) get(key [sha256.Size]byte) ([]float64, bool) {
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.recent.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*cacheEntry).vector, true
+	}
+	c.mu.Unlock()
+
+	if c.store == nil {
+		return nil, false
+	}
+
+	var vector []float64
+	c.store.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(CacheBucket)).Get(key[:]); b != nil {
+			vector = decodeVector(b)
+		}
+		return nil
+	})
+
+	if vector == nil {
+		return nil, false
+	}
+
+	c.remember(key, vector)
+
+	return vector, true
+}
+
+// put caches the vectors of keys, persisting all of them in a single
+// transaction.
+func (c *Cache) put(keys [][sha256.Size]byte, vectors [][]float64) {
+	for i, key := range keys {
+		c.remember(key, vectors[i])
+	}
+
+	if c.store == nil {
+		return
+	}
+
+	//a vector that fails to persist is simply embedded again after a restart
+	c.store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(CacheBucket))
+		for i, key := range keys {
+			if err := b.Put(key[:], encodeVector(vectors[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// remember adds a vector to the in-memory cache, evicting the least recently
+// used one when it is full.
+func (c *Cache) remember(key [sha256.Size]byte, vector []float64) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.recent.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.recent.PushFront(&cacheEntry{key: key, vector: vector})
+
+	if c.recent.Len() > c.size {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func encodeVector(vector []float64) []byte {
+	b := make([]byte, 8*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint64(b[8*i:], math.Float64bits(v))
+	}
+	return b
+}
+
+func decodeVector(b []byte) []float64 {
+	vector := make([]float64, len(b)/8)
+	for i := range vector {
+		vector[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[8*i:]))
+	}
+	return vector
+}
@@ -0,0 +1,136 @@
+package embedding
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type countingEmbedder struct {
+	Embedder
+	texts []string
+}
+
+func (c *countingEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	c.texts = append(c.texts, text)
+	return c.Embedder.Embed(ctx, text)
+}
+
+func (c *countingEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	c.texts = append(c.texts, texts...)
+	return c.Embedder.EmbedBatch(ctx, texts)
+}
+
+func TestCache(t *testing.T) {
+	embedder := &countingEmbedder{Embedder: NewHashing(8)}
+	c, err := NewCache(embedder, 2, nil, "hashing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Embed(context.Background(), "a")
+	c.Embed(context.Background(), "b")
+	c.Embed(context.Background(), "a")
+	//b is the least recently used and makes room for c
+	c.Embed(context.Background(), "c")
+	c.Embed(context.Background(), "b")
+
+	expected := []string{"a", "b", "c", "b"}
+	if !reflect.DeepEqual(embedder.texts, expected) {
+		t.Fatalf("expected %v, got %v", expected, embedder.texts)
+	}
+
+	if c.Len() != 2 {
+		t.Fatalf("expected %v, got %v", 2, c.Len())
+	}
+
+	embedder.texts = nil
+	vectors, err := c.EmbedBatch(context.Background(), []string{"b", "d", "c", "e"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []string{"d", "e"}
+	if !reflect.DeepEqual(embedder.texts, expected) {
+		t.Fatalf("expected %v, got %v", expected, embedder.texts)
+	}
+
+	d, _ := NewHashing(8).Embed(context.Background(), "d")
+	if !reflect.DeepEqual(vectors[1], d) {
+		t.Fatalf("expected %v, got %v", d, vectors[1])
+	}
+}
+
+func TestCachePersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings")
+
+	store, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	embedder := &countingEmbedder{Embedder: NewHashing(8)}
+	c, err := NewCache(embedder, 10, store, "hashing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, _ := c.Embed(context.Background(), "persisted text")
+	store.Close()
+
+	store, err = bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	embedder = &countingEmbedder{Embedder: NewHashing(8)}
+	c, _ = NewCache(embedder, 10, store, "hashing")
+
+	vector, _ := c.Embed(context.Background(), "persisted text")
+	if len(embedder.texts) != 0 || !reflect.DeepEqual(vector, expected) {
+		t.Fatalf("expected %v from the store, got %v after %v calls", expected, vector, len(embedder.texts))
+	}
+
+	//another model never sees the vectors of the first one
+	other, _ := NewCache(embedder, 10, store, "openai")
+	other.Embed(context.Background(), "persisted text")
+	if len(embedder.texts) != 1 {
+		t.Fatalf("expected %v, got %v", 1, len(embedder.texts))
+	}
+}
+
+func TestCachePersistedBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings")
+
+	store, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCache(NewHashing(8), 10, store, "hashing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	texts := []string{"a", "b", "c"}
+	expected, _ := c.EmbedBatch(context.Background(), texts)
+	store.Close()
+
+	store, err = bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	embedder := &countingEmbedder{Embedder: NewHashing(8)}
+	c, _ = NewCache(embedder, 10, store, "hashing")
+
+	vectors, _ := c.EmbedBatch(context.Background(), texts)
+	if len(embedder.texts) != 0 || !reflect.DeepEqual(vectors, expected) {
+		t.Fatalf("expected %v from the store, got %v after %v calls", expected, vectors, len(embedder.texts))
+	}
+}
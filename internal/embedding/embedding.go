@@ -0,0 +1,125 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	FastAPIProvider = "fastapi"
+	OpenAIProvider  = "openai"
+	HashingProvider = "hashing"
+
+	// DefaultDimensions is the size of the vectors of the hashing embedder,
+	// that of the sentence transformer served by third_party.
+	DefaultDimensions = 768
+
+	defaultTimeout = 30 * time.Second
+)
+
+// Embedder turns text into a dense vector. Calls give up when ctx is done.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+	// EmbedBatch embeds several texts in one request, returning their vectors
+	// in the same order.
+	EmbedBatch(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// SparseEmbedder turns texts into sparse term weights, as learned sparse
+// models like SPLADE do, returning them in the same order.
+type SparseEmbedder interface {
+	EmbedSparse(ctx context.Context, texts []string) ([]map[string]float64, error)
+}
+
+// Config selects and configures an embedder.
+type Config struct {
+	// Provider is one of fastapi, openai or hashing.
+	Provider string
+	// URL is the endpoint of the fastapi service or the base URL of the
+	// OpenAI-compatible API.
+	URL string
+	// Model is the model requested from the OpenAI-compatible API.
+	Model string
+	// APIKey authenticates against the OpenAI-compatible API.
+	APIKey string
+	// Dimensions is the size of the vectors of the hashing embedder.
+	Dimensions int
+}
+
+// New returns the embedder described by config.
+func New(config Config) (Embedder, error) {
+	switch config.Provider {
+	case "", FastAPIProvider:
+		if config.URL == "" {
+			return nil, fmt.Errorf("embedding: no url for the %s provider", FastAPIProvider)
+		}
+		return NewFastAPI(config.URL), nil
+	case OpenAIProvider:
+		if config.URL == "" || config.Model == "" {
+			return nil, fmt.Errorf("embedding: the %s provider needs a url and a model", OpenAIProvider)
+		}
+		return NewOpenAI(config.URL, config.Model, config.APIKey), nil
+	case HashingProvider:
+		if config.Dimensions <= 0 {
+			config.Dimensions = DefaultDimensions
+		}
+		return NewHashing(config.Dimensions), nil
+	default:
+		return nil, fmt.Errorf("embedding: unknown provider %q", config.Provider)
+	}
+}
+
+// Namespace identifies the vectors produced by the embedder of config, so
+// vectors cached for one model are never returned for another.
+func (c Config) Namespace() string {
+	return fmt.Sprintf("%s|%s|%s|%d", c.Provider, c.URL, c.Model, c.Dimensions)
+}
+
+// Default returns the fastapi embedder pointed to by the EmbeddingHost
+// environment variable, with the default deadlines, retries and circuit
+// breaker.
+func Default() Embedder {
+	return NewResilient(NewFastAPI(os.Getenv("EmbeddingHost")), ResilientConfig{Retries: DefaultRetries})
+}
+
+// checkBatch makes sure a service returned one vector per text.
+func checkBatch(texts []string, vectors [][]float64) error {
+	if len(vectors) != len(texts) {
+		return fmt.Errorf("embedding: service returned %d vectors for %d texts", len(vectors), len(texts))
+	}
+
+	for i, vector := range vectors {
+		if len(vector) == 0 {
+			return fmt.Errorf("embedding: service returned an empty vector for text %d", i)
+		}
+	}
+
+	return nil
+}
+
+// StatusError is returned when an embedding service answers with a non-2xx
+// status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("embedding: service returned %d: %s", e.StatusCode, e.Body)
+}
+
+// checkStatus turns a non-2xx response into a StatusError carrying the start
+// of its body.
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+}
@@ -0,0 +1,204 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFastAPI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := TextEmbeddingRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Text != "hello" {
+			t.Fatalf("expected %v, got %v", "hello", req.Text)
+		}
+		json.NewEncoder(w).Encode(TextEmbeddingResponse{Status: "success", Data: []float64{0.1, 0.2}})
+	}))
+	defer srv.Close()
+
+	vector, err := NewFastAPI(srv.URL).Embed(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vector) != 2 || vector[1] != 0.2 {
+		t.Fatalf("expected %v, got %v", []float64{0.1, 0.2}, vector)
+	}
+}
+
+func TestFastAPIBatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings/batch" {
+			t.Fatalf("expected %v, got %v", "/embeddings/batch", r.URL.Path)
+		}
+
+		req := BatchEmbeddingRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		data := [][]float64{}
+		for i := range req.Texts {
+			data = append(data, []float64{float64(i)})
+		}
+		json.NewEncoder(w).Encode(BatchEmbeddingResponse{Status: "success", Data: data})
+	}))
+	defer srv.Close()
+
+	vectors, err := NewFastAPI(srv.URL+"/embeddings").EmbedBatch(context.Background(), []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vectors) != 3 || vectors[2][0] != 2 {
+		t.Fatalf("expected %v, got %v", [][]float64{{0}, {1}, {2}}, vectors)
+	}
+}
+
+func TestFastAPISparse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings/sparse" {
+			t.Fatalf("expected %v, got %v", "/embeddings/sparse", r.URL.Path)
+		}
+
+		req := BatchEmbeddingRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		data := []map[string]float64{}
+		for _, text := range req.Texts {
+			data = append(data, map[string]float64{text: 1.5})
+		}
+		json.NewEncoder(w).Encode(SparseEmbeddingResponse{Status: "success", Data: data})
+	}))
+	defer srv.Close()
+
+	vectors, err := NewFastAPI(srv.URL+"/embeddings").EmbedSparse(context.Background(), []string{"raft", "paxos"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vectors) != 2 || vectors[1]["paxos"] != 1.5 {
+		t.Fatalf("expected %v, got %v", []map[string]float64{{"raft": 1.5}, {"paxos": 1.5}}, vectors)
+	}
+}
+
+func TestFastAPIStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not loaded", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	_, err := NewFastAPI(srv.URL).Embed(context.Background(), "hello")
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected %v, got %v", http.StatusServiceUnavailable, err)
+	}
+}
+
+func TestOpenAI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Fatalf("expected %v, got %v", "/v1/embeddings", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Fatalf("expected %v, got %v", "Bearer secret", r.Header.Get("Authorization"))
+		}
+
+		req := openAIRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "text-embedding-3-small" || len(req.Input) != 1 {
+			t.Fatalf("expected %v, got %v", "text-embedding-3-small", req)
+		}
+
+		w.Write([]byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.5,-0.5]}]}`))
+	}))
+	defer srv.Close()
+
+	vector, err := NewOpenAI(srv.URL+"/", "text-embedding-3-small", "secret").Embed(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vector) != 2 || vector[0] != 0.5 {
+		t.Fatalf("expected %v, got %v", []float64{0.5, -0.5}, vector)
+	}
+}
+
+func TestOpenAIBatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[1]},{"index":0,"embedding":[0]}]}`))
+	}))
+	defer srv.Close()
+
+	o := NewOpenAI(srv.URL, "model", "")
+
+	vectors, err := o.EmbedBatch(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vectors[0][0] != 0 || vectors[1][0] != 1 {
+		t.Fatalf("expected %v, got %v", [][]float64{{0}, {1}}, vectors)
+	}
+
+	if _, err := o.EmbedBatch(context.Background(), []string{"a", "b", "c"}); err == nil {
+		t.Fatalf("expected an error for a missing embedding")
+	}
+}
+
+func TestHashing(t *testing.T) {
+	h := NewHashing(64)
+
+	a, _ := h.Embed(context.Background(), "Distributed search engines")
+	b, _ := h.Embed(context.Background(), "distributed search engines")
+	c, _ := h.Embed(context.Background(), "chocolate cake recipe")
+
+	if len(a) != 64 {
+		t.Fatalf("expected %v, got %v", 64, len(a))
+	}
+
+	if cosine(a, b) < 0.999 {
+		t.Fatalf("expected identical vectors, got similarity %v", cosine(a, b))
+	}
+
+	if cosine(a, c) >= cosine(a, b) {
+		t.Fatalf("expected unrelated text to be less similar, got %v", cosine(a, c))
+	}
+
+	norm := math.Sqrt(cosine(a, a))
+	if math.Abs(norm-1) > 1e-9 {
+		t.Fatalf("expected %v, got %v", 1, norm)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(Config{Provider: "unknown"}); err == nil {
+		t.Fatalf("expected an error for an unknown provider")
+	}
+
+	if _, err := New(Config{Provider: OpenAIProvider, URL: "http://localhost"}); err == nil {
+		t.Fatalf("expected an error for a missing model")
+	}
+
+	e, err := New(Config{Provider: HashingProvider})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, _ := e.Embed(context.Background(), "hello")
+	if len(vector) != DefaultDimensions {
+		t.Fatalf("expected %v, got %v", DefaultDimensions, len(vector))
+	}
+}
+
+func cosine(a, b []float64) float64 {
+	dot := 0.
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot
+}
@@ -0,0 +1,125 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type TextEmbeddingRequest struct {
+	Text string `json:"text"`
+}
+
+type TextEmbeddingResponse struct {
+	Status string    `json:"status"`
+	Data   []float64 `json:"data"`
+}
+
+type BatchEmbeddingRequest struct {
+	Texts []string `json:"texts"`
+}
+
+type BatchEmbeddingResponse struct {
+	Status string      `json:"status"`
+	Data   [][]float64 `json:"data"`
+}
+
+type SparseEmbeddingResponse struct {
+	Status string               `json:"status"`
+	Data   []map[string]float64 `json:"data"`
+}
+
+// FastAPI embeds text with the sentence transformer service in third_party.
+// Batches are posted to the /batch route under url and sparse embeddings to
+// the /sparse route.
+type FastAPI struct {
+	url    string
+	client *http.Client
+}
+
+func NewFastAPI(url string) *FastAPI {
+	return &FastAPI{url: strings.TrimSuffix(url, "/"), client: &http.Client{Timeout: defaultTimeout}}
+}
+
+func (f *FastAPI) Embed(ctx context.Context, text string) ([]float64, error) {
+	var embedding TextEmbeddingResponse
+	if err := f.post(ctx, f.url, TextEmbeddingRequest{Text: text}, &embedding); err != nil {
+		return nil, err
+	}
+
+	if embedding.Status != "success" || len(embedding.Data) == 0 {
+		return nil, fmt.Errorf("embedding: service returned status %q with %d dimensions", embedding.Status, len(embedding.Data))
+	}
+
+	return embedding.Data, nil
+}
+
+func (f *FastAPI) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return [][]float64{}, nil
+	}
+
+	var embeddings BatchEmbeddingResponse
+	if err := f.post(ctx, f.url+"/batch", BatchEmbeddingRequest{Texts: texts}, &embeddings); err != nil {
+		return nil, err
+	}
+
+	if embeddings.Status != "success" {
+		return nil, fmt.Errorf("embedding: service returned status %q", embeddings.Status)
+	}
+
+	if err := checkBatch(texts, embeddings.Data); err != nil {
+		return nil, err
+	}
+
+	return embeddings.Data, nil
+}
+
+func (f *FastAPI) EmbedSparse(ctx context.Context, texts []string) ([]map[string]float64, error) {
+	if len(texts) == 0 {
+		return []map[string]float64{}, nil
+	}
+
+	var embeddings SparseEmbeddingResponse
+	if err := f.post(ctx, f.url+"/sparse", BatchEmbeddingRequest{Texts: texts}, &embeddings); err != nil {
+		return nil, err
+	}
+
+	if embeddings.Status != "success" {
+		return nil, fmt.Errorf("embedding: service returned status %q", embeddings.Status)
+	}
+
+	if len(embeddings.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding: service returned %d sparse vectors for %d texts", len(embeddings.Data), len(texts))
+	}
+
+	return embeddings.Data, nil
+}
+
+func (f *FastAPI) post(ctx context.Context, url string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	r, err := f.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if err := checkStatus(r); err != nil {
+		return err
+	}
+
+	return json.NewDecoder(r.Body).Decode(resp)
+}
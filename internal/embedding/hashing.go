@@ -0,0 +1,75 @@
+package embedding
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Hashing embeds text locally by hashing its words and their character
+// trigrams into a fixed number of dimensions. It needs no model or network,
+// which makes it deterministic for tests and usable offline, but it only
+// captures lexical similarity.
+type Hashing struct {
+	dimensions int
+}
+
+func NewHashing(dimensions int) *Hashing {
+	return &Hashing{dimensions: dimensions}
+}
+
+func (h *Hashing) Embed(ctx context.Context, text string) ([]float64, error) {
+	vector := make([]float64, h.dimensions)
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	for _, word := range words {
+		h.add(vector, word, 1)
+
+		//trigrams make words sharing a stem or a typo land close together
+		runes := []rune("#" + word + "#")
+		for i := 0; i+3 <= len(runes); i++ {
+			h.add(vector, string(runes[i:i+3]), 0.5)
+		}
+	}
+
+	norm := 0.
+	for _, v := range vector {
+		norm += v * v
+	}
+
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] /= norm
+		}
+	}
+
+	return vector, nil
+}
+
+func (h *Hashing) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i], _ = h.Embed(ctx, text)
+	}
+	return vectors, nil
+}
+
+// add hashes feature into a dimension, using a second bit of the hash as its
+// sign so collisions cancel out on average.
+func (h *Hashing) add(vector []float64, feature string, weight float64) {
+	hash := fnv.New64a()
+	hash.Write([]byte(feature))
+	sum := hash.Sum64()
+
+	if sum&(1<<63) != 0 {
+		weight = -weight
+	}
+
+	vector[sum%uint64(h.dimensions)] += weight
+}
@@ -0,0 +1,101 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type openAIRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIResponse struct {
+	Data []struct {
+		Embedding []float64 `json:"embedding"`
+		Index     int       `json:"index"`
+	} `json:"data"`
+}
+
+// OpenAI embeds text with any API compatible with the OpenAI /v1/embeddings
+// endpoint.
+type OpenAI struct {
+	url    string
+	model  string
+	apiKey string
+	client *http.Client
+}
+
+// NewOpenAI returns an embedder for the API at baseURL, e.g.
+// https://api.openai.com.
+func NewOpenAI(baseURL, model, apiKey string) *OpenAI {
+	return &OpenAI{
+		url:    strings.TrimSuffix(baseURL, "/") + "/v1/embeddings",
+		model:  model,
+		apiKey: apiKey,
+		client: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+func (o *OpenAI) Embed(ctx context.Context, text string) ([]float64, error) {
+	vectors, err := o.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+
+	return vectors[0], nil
+}
+
+func (o *OpenAI) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return [][]float64{}, nil
+	}
+
+	body, err := json.Marshal(openAIRequest{Model: o.model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+
+	var embeddings openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embeddings); err != nil {
+		return nil, err
+	}
+
+	//the API may return embeddings out of order, each carrying the index of its input
+	vectors := make([][]float64, len(embeddings.Data))
+	for _, d := range embeddings.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding: service returned an embedding for input %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+
+	if err := checkBatch(texts, vectors); err != nil {
+		return nil, err
+	}
+
+	return vectors, nil
+}
@@ -0,0 +1,213 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCallTimeout      = 10 * time.Second
+	DefaultRetries          = 2
+	DefaultBackoff          = 100 * time.Millisecond
+	DefaultMaxBackoff       = 2 * time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without calling the embedding service while the
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("embedding: circuit breaker is open")
+
+// ResilientConfig tunes the deadlines, retries and circuit breaker of a
+// Resilient embedder. Zero durations and thresholds take the defaults above,
+// Retries is used as is.
+type ResilientConfig struct {
+	// Timeout is the deadline of each attempt.
+	Timeout time.Duration
+	// Retries is the number of attempts made after the first one fails.
+	Retries int
+	// Backoff is the base delay before a retry, doubled on every attempt up
+	// to MaxBackoff. The actual delay is picked at random below it.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// BreakerThreshold is the number of consecutive failed attempts opening
+	// the circuit breaker.
+	BreakerThreshold int
+	// BreakerCooldown is how long the breaker stays open before a single
+	// trial call is let through.
+	BreakerCooldown time.Duration
+}
+
+func (c *ResilientConfig) setDefaults() {
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultCallTimeout
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = DefaultBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = DefaultMaxBackoff
+	}
+	if c.BreakerThreshold <= 0 {
+		c.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if c.BreakerCooldown <= 0 {
+		c.BreakerCooldown = DefaultBreakerCooldown
+	}
+}
+
+// Resilient wraps an embedder with a deadline on every attempt, retries
+// with jittered exponential backoff and a circuit breaker. Once the service
+// has failed BreakerThreshold times in a row, calls fail fast with
+// ErrCircuitOpen for BreakerCooldown, after which one trial call decides
+// whether the breaker closes again.
+type Resilient struct {
+	embedder Embedder
+	config   ResilientConfig
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func NewResilient(embedder Embedder, config ResilientConfig) *Resilient {
+	config.setDefaults()
+	return &Resilient{embedder: embedder, config: config}
+}
+
+func (r *Resilient) Embed(ctx context.Context, text string) ([]float64, error) {
+	var vector []float64
+	err := r.do(ctx, func(ctx context.Context) (err error) {
+		vector, err = r.embedder.Embed(ctx, text)
+		return err
+	})
+	return vector, err
+}
+
+func (r *Resilient) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	var vectors [][]float64
+	err := r.do(ctx, func(ctx context.Context) (err error) {
+		vectors, err = r.embedder.EmbedBatch(ctx, texts)
+		return err
+	})
+	return vectors, err
+}
+
+func (r *Resilient) do(ctx context.Context, call func(context.Context) error) error {
+	var err error
+
+	for attempt := 0; attempt <= r.config.Retries; attempt++ {
+		if attempt > 0 {
+			if waitErr := r.wait(ctx, attempt); waitErr != nil {
+				return waitErr
+			}
+		}
+
+		if !r.allow() {
+			return ErrCircuitOpen
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+		err = call(attemptCtx)
+		cancel()
+
+		//the caller giving up says nothing about the health of the service
+		if ctx.Err() != nil {
+			r.release()
+			return ctx.Err()
+		}
+
+		if err == nil || !retriable(err) {
+			r.record(nil)
+			return err
+		}
+
+		r.record(err)
+	}
+
+	return err
+}
+
+// wait sleeps before a retry, for a random duration below the exponential
+// backoff of the attempt.
+func (r *Resilient) wait(ctx context.Context, attempt int) error {
+	backoff := r.config.Backoff << (attempt - 1)
+	if backoff > r.config.MaxBackoff || backoff <= 0 {
+		backoff = r.config.MaxBackoff
+	}
+
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(backoff)) + 1))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// allow reports whether a call may go through the breaker. When the cooldown
+// of an open breaker is over, only one trial call is allowed until it
+// completes.
+func (r *Resilient) allow() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures < r.config.BreakerThreshold {
+		return true
+	}
+
+	if time.Now().Before(r.openUntil) || r.trial {
+		return false
+	}
+
+	r.trial = true
+	return true
+}
+
+// release ends a call without recording its outcome, so a cancelled trial
+// call lets the next one through without closing the breaker.
+func (r *Resilient) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.trial = false
+}
+
+func (r *Resilient) record(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.trial = false
+
+	if err == nil {
+		r.failures = 0
+		return
+	}
+
+	r.failures++
+	if r.failures >= r.config.BreakerThreshold {
+		r.openUntil = time.Now().Add(r.config.BreakerCooldown)
+	}
+}
+
+// retriable reports whether err may be fixed by trying again: transport
+// errors, timeouts, rate limiting and server errors.
+func retriable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == 429 || statusErr.StatusCode >= 500
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,166 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResilientRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "warming up", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status": "success", "data": [1, 2]}`))
+	}))
+	defer srv.Close()
+
+	r := NewResilient(NewFastAPI(srv.URL), ResilientConfig{Retries: 2, Backoff: time.Millisecond})
+
+	vector, err := r.Embed(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vector) != 2 || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("expected %v calls, got %v", 3, calls)
+	}
+}
+
+func TestResilientNoRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "bad input", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	r := NewResilient(NewFastAPI(srv.URL), ResilientConfig{Retries: 2, Backoff: time.Millisecond})
+
+	if _, err := r.Embed(context.Background(), "hello"); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("expected %v, got %v", 1, calls)
+	}
+}
+
+func TestResilientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	r := NewResilient(NewFastAPI(srv.URL), ResilientConfig{Timeout: 20 * time.Millisecond, Retries: 1, Backoff: time.Millisecond})
+
+	start := time.Now()
+	if _, err := r.Embed(context.Background(), "hello"); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the call to give up after its deadline, took %v", elapsed)
+	}
+}
+
+func TestResilientCircuitBreaker(t *testing.T) {
+	var calls int32
+	healthy := int32(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"status": "success", "data": [1]}`))
+	}))
+	defer srv.Close()
+
+	r := NewResilient(NewFastAPI(srv.URL), ResilientConfig{
+		Retries:          0,
+		BreakerThreshold: 2,
+		BreakerCooldown:  50 * time.Millisecond,
+	})
+
+	r.Embed(context.Background(), "a")
+	r.Embed(context.Background(), "b")
+
+	_, err := r.Embed(context.Background(), "c")
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected %v, got %v", ErrCircuitOpen, err)
+	}
+
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("expected %v, got %v", 2, calls)
+	}
+
+	//after the cooldown a successful trial call closes the breaker
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(60 * time.Millisecond)
+
+	if _, err := r.Embed(context.Background(), "d"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Embed(context.Background(), "e"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResilientCancelledTrial(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//the first call fails, later ones hang until the caller gives up
+		if atomic.AddInt32(&calls, 1) == 1 {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	r := NewResilient(NewFastAPI(srv.URL), ResilientConfig{
+		Retries:          0,
+		BreakerThreshold: 1,
+		BreakerCooldown:  20 * time.Millisecond,
+	})
+
+	r.Embed(context.Background(), "a")
+	time.Sleep(30 * time.Millisecond)
+
+	//the caller cancels the trial call of the open breaker
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := r.Embed(ctx, "b"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	if r.failures != 1 || r.trial {
+		t.Fatalf("expected the breaker to stay open, got %v failures and trial %v", r.failures, r.trial)
+	}
+
+	//the cooldown is over, so the next call is a new trial
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.Embed(ctx, "c"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
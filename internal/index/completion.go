@@ -0,0 +1,116 @@
+package index
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sort"
+)
+
+// Completion maps the surface form of every indexed word to the number of
+// documents it appears in. Words are kept in a sorted dictionary so the
+// completions of a prefix are a range scan away.
+type Completion struct {
+	Weights    map[string]int
+	dictionary TermDictionary
+}
+
+type CompletionTerm struct {
+	Term   string
+	Weight int
+}
+
+func NewCompletion() *Completion {
+	return &Completion{Weights: map[string]int{}}
+}
+
+// Add records the words of a single document.
+func (c *Completion) Add(words []string) {
+	if c.Weights == nil {
+		c.Weights = map[string]int{}
+	}
+
+	seen := map[string]bool{}
+	for _, word := range words {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+
+		if _, ok := c.Weights[word]; !ok {
+			c.dictionary.Add(word)
+		}
+		c.Weights[word]++
+	}
+}
+
+// Complete returns the n heaviest words starting with prefix.
+func (c *Completion) Complete(prefix string, n int) []CompletionTerm {
+	terms := c.Matches(prefix)
+
+	SortCompletions(terms)
+
+	if len(terms) > n {
+		terms = terms[:n]
+	}
+
+	return terms
+}
+
+// Matches returns every word starting with prefix with its weight, in
+// dictionary order.
+func (c *Completion) Matches(prefix string) []CompletionTerm {
+	terms := []CompletionTerm{}
+	for _, term := range c.dictionary.Prefix(prefix) {
+		terms = append(terms, CompletionTerm{Term: term, Weight: c.Weights[term]})
+	}
+	return terms
+}
+
+// Fuzzy returns the words within maxEdits of word, at most limit of them.
+func (c *Completion) Fuzzy(word string, maxEdits int, limit int) []FuzzyTerm {
+	return c.dictionary.Fuzzy(word, maxEdits, limit)
+}
+
+// SortCompletions orders completions by descending weight, breaking ties
+// alphabetically.
+func SortCompletions(terms []CompletionTerm) {
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Weight != terms[j].Weight {
+			return terms[i].Weight > terms[j].Weight
+		}
+		return terms[i].Term < terms[j].Term
+	})
+}
+
+func (c *Completion) Encode() ([]byte, error) {
+	var b bytes.Buffer
+	enc := gob.NewEncoder(&b)
+
+	err := enc.Encode(c)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (c *Completion) Decode(b []byte) error {
+	buf := bytes.NewBuffer(b)
+	dec := gob.NewDecoder(buf)
+	err := dec.Decode(c)
+
+	if err != nil {
+		return err
+	}
+
+	if c.Weights == nil {
+		c.Weights = map[string]int{}
+	}
+
+	terms := make([]string, 0, len(c.Weights))
+	for term := range c.Weights {
+		terms = append(terms, term)
+	}
+	c.dictionary.Set(terms)
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompletionComplete(t *testing.T) {
+	index := NewInvertedIndex()
+
+	index.Index(1, "Gotham needs a hero")
+	index.Index(2, "I have come to save Gotham!")
+	index.Index(3, "the gothic cathedral of Gotham, Gotham")
+
+	expected := []CompletionTerm{{Term: "gotham", Weight: 3}, {Term: "gothic", Weight: 1}}
+
+	got := index.Completion.Complete("got", 5)
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestCompletionDecode(t *testing.T) {
+	completion := NewCompletion()
+	completion.Add([]string{"running", "runner"})
+	completion.Add([]string{"running"})
+
+	b, err := completion.Encode()
+	if err != nil {
+		t.Fatalf("completion encode returned an error")
+	}
+
+	var reloaded Completion
+	err = reloaded.Decode(b)
+	if err != nil {
+		t.Fatalf("completion decode returned an error")
+	}
+
+	expected := []CompletionTerm{{Term: "running", Weight: 2}}
+
+	got := reloaded.Complete("run", 1)
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,235 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultMaxExpansions caps the number of dictionary terms a single
+	// wildcard term expands to when no limit has been configured.
+	DefaultMaxExpansions = 50
+)
+
+// TermDictionary keeps the terms of an inverted index in sorted order so
+// wildcard terms can be expanded with a range scan over their literal prefix.
+// Added terms are only merged into the sorted terms on the next lookup, so
+// building a dictionary term by term stays linearithmic.
+type TermDictionary struct {
+	mu       sync.Mutex
+	terms    []string
+	unsorted []string
+}
+
+func NewTermDictionary(terms []string) *TermDictionary {
+	d := &TermDictionary{}
+	d.Set(terms)
+
+	return d
+}
+
+// Set replaces the terms of the dictionary.
+func (d *TermDictionary) Set(terms []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.terms = nil
+	d.unsorted = append([]string{}, terms...)
+}
+
+func (d *TermDictionary) Add(term string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.unsorted = append(d.unsorted, term)
+}
+
+// sorted merges the terms added since the last lookup into the sorted terms
+// and returns them. The merge always builds a new slice, so terms returned by
+// earlier lookups are never modified.
+func (d *TermDictionary) sorted() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.unsorted) == 0 {
+		return d.terms
+	}
+
+	sort.Strings(d.unsorted)
+
+	merged := make([]string, 0, len(d.terms)+len(d.unsorted))
+	i, j := 0, 0
+	for i < len(d.terms) || j < len(d.unsorted) {
+		var term string
+		if j == len(d.unsorted) || (i < len(d.terms) && d.terms[i] <= d.unsorted[j]) {
+			term = d.terms[i]
+			i++
+		} else {
+			term = d.unsorted[j]
+			j++
+		}
+
+		//terms added twice are kept once
+		if len(merged) > 0 && merged[len(merged)-1] == term {
+			continue
+		}
+		merged = append(merged, term)
+	}
+
+	d.terms, d.unsorted = merged, nil
+
+	return d.terms
+}
+
+func (d *TermDictionary) Len() int {
+	return len(d.sorted())
+}
+
+func (d *TermDictionary) Terms() []string {
+	return d.sorted()
+}
+
+// Prefix returns every term starting with prefix.
+func (d *TermDictionary) Prefix(prefix string) []string {
+	terms := d.sorted()
+	start := sort.SearchStrings(terms, prefix)
+	end := start
+	for end < len(terms) && strings.HasPrefix(terms[end], prefix) {
+		end++
+	}
+
+	return terms[start:end]
+}
+
+// Expand returns up to limit terms matching pattern, where '*' matches any
+// run of characters and '?' matches exactly one.
+func (d *TermDictionary) Expand(pattern string, limit int) []string {
+	if limit <= 0 {
+		limit = DefaultMaxExpansions
+	}
+
+	literal := pattern
+	if idx := strings.IndexAny(pattern, "*?"); idx >= 0 {
+		literal = pattern[:idx]
+	}
+
+	terms := []string{}
+	for _, term := range d.Prefix(literal) {
+		if len(terms) >= limit {
+			break
+		}
+
+		if matchWildcard(pattern, term) {
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+// FuzzyTerm is a dictionary term matched by a fuzzy query together with its
+// edit distance from the query term.
+type FuzzyTerm struct {
+	Term     string
+	Distance int
+}
+
+// Fuzzy returns up to limit terms within maxEdits edits of term, closest
+// first. The Levenshtein automaton for term is intersected with the sorted
+// dictionary, so whole ranges of terms sharing a prefix the automaton has
+// rejected are skipped.
+func (d *TermDictionary) Fuzzy(term string, maxEdits int, limit int) []FuzzyTerm {
+	if limit <= 0 {
+		limit = DefaultMaxExpansions
+	}
+
+	terms := d.sorted()
+	automaton := newLevenshteinAutomaton(term, maxEdits)
+	states := []levenshteinState{automaton.start()}
+	previous := []rune{}
+	matches := []FuzzyTerm{}
+
+	for idx := 0; idx < len(terms); {
+		candidate := []rune(terms[idx])
+
+		//reuse the states computed for the prefix shared with the previous term
+		common := 0
+		for common < len(previous) && common < len(candidate) && previous[common] == candidate[common] {
+			common++
+		}
+		states = states[:common+1]
+
+		rejected := -1
+		for k := common; k < len(candidate); k++ {
+			next := automaton.step(states[k], candidate[k])
+			if !automaton.canMatch(next) {
+				rejected = k + 1
+				break
+			}
+			states = append(states, next)
+		}
+
+		if rejected > 0 {
+			idx = skipPrefix(terms, string(candidate[:rejected]), idx)
+			previous = candidate[:rejected-1]
+			continue
+		}
+
+		if automaton.isMatch(states[len(candidate)]) {
+			matches = append(matches, FuzzyTerm{Term: terms[idx], Distance: automaton.distance(states[len(candidate)])})
+		}
+
+		previous = candidate
+		idx++
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Distance < matches[j].Distance
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches
+}
+
+// skipPrefix returns the index of the first of the sorted terms from idx
+// onwards that does not start with prefix.
+func skipPrefix(terms []string, prefix string, idx int) int {
+	return idx + sort.Search(len(terms)-idx, func(k int) bool {
+		term := terms[idx+k]
+		return term > prefix && !strings.HasPrefix(term, prefix)
+	})
+}
+
+func matchWildcard(pattern, term string) bool {
+	p, t := []rune(pattern), []rune(term)
+	pi, ti := 0, 0
+	star, mark := -1, 0
+
+	for ti < len(t) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == t[ti]):
+			pi++
+			ti++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ti
+			pi++
+		case star >= 0:
+			//backtrack and let the last star swallow one more rune
+			pi = star + 1
+			mark++
+			ti = mark
+		default:
+			return false
+		}
+	}
+
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+
+	return pi == len(p)
+}
@@ -0,0 +1,87 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTermDictionaryExpandPrefix(t *testing.T) {
+	dictionary := NewTermDictionary([]string{"foobar", "food", "fob", "bar", "foo"})
+
+	expected := []string{"foo", "foobar", "food"}
+
+	got := dictionary.Expand("foo*", 10)
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestTermDictionaryExpandWildcard(t *testing.T) {
+	dictionary := NewTermDictionary([]string{"foobar", "fxobazbar", "fobar", "foo", "fooba"})
+
+	expected := []string{"foobar", "fxobazbar"}
+
+	got := dictionary.Expand("f?o*bar", 10)
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestTermDictionaryExpandLimit(t *testing.T) {
+	dictionary := NewTermDictionary([]string{"a1", "a2", "a3", "a4"})
+
+	got := dictionary.Expand("a*", 2)
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 expansions, got %v", got)
+	}
+}
+
+func TestTermDictionaryFuzzy(t *testing.T) {
+	dictionary := NewTermDictionary([]string{"gotham", "gothic", "batman", "goth", "gotam", "hotham"})
+
+	expected := []FuzzyTerm{{Term: "gotham", Distance: 0}, {Term: "gotam", Distance: 1}, {Term: "hotham", Distance: 1}}
+
+	got := dictionary.Fuzzy("gotham", 1, 10)
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestTermDictionaryFuzzyTwoEdits(t *testing.T) {
+	dictionary := NewTermDictionary([]string{"gotham", "goth", "batman", "go"})
+
+	expected := []FuzzyTerm{{Term: "goth", Distance: 1}, {Term: "go", Distance: 2}, {Term: "gotham", Distance: 2}}
+
+	got := dictionary.Fuzzy("gotm", 2, 10)
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestTermDictionaryAdd(t *testing.T) {
+	dictionary := NewTermDictionary([]string{"joker"})
+	dictionary.Add("gotham")
+	dictionary.Add("batman")
+
+	prefix := dictionary.Prefix("")
+
+	dictionary.Add("alfred")
+	dictionary.Add("gotham")
+	dictionary.Add("robin")
+
+	//terms added after a lookup are merged in without touching its result
+	expected := []string{"batman", "gotham", "joker"}
+	if !reflect.DeepEqual(expected, prefix) {
+		t.Fatalf("expected %v, got %v", expected, prefix)
+	}
+
+	expected = []string{"alfred", "batman", "gotham", "joker", "robin"}
+	if got := dictionary.Terms(); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
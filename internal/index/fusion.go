@@ -0,0 +1,293 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// RRFFusion sums the weighted reciprocal ranks of a document.
+	RRFFusion = "rrf"
+	// LinearFusion sums the weighted normalized scores of a document.
+	LinearFusion = "linear"
+	// FTSFusion only ranks by the full-text score.
+	FTSFusion = "fts"
+	// SemanticFusion only ranks by vector similarity.
+	SemanticFusion = "semantic"
+	// SparseFusion only ranks by the sparse vector dot product.
+	SparseFusion = "sparse"
+
+	MinMaxNormalization = "minmax"
+	ZScoreNormalization = "zscore"
+
+	// DefaultRRFK is the rank constant of RRF: the larger it is, the less the
+	// top ranks of one source dominate.
+	DefaultRRFK = 60
+)
+
+// Fusion describes how the full-text, semantic and sparse results of a
+// search are combined. The zero value is RRF with k=60 and equal weights.
+type Fusion struct {
+	Strategy string
+	// K is the RRF rank constant.
+	K float64
+	// FTSWeight, SemanticWeight and SparseWeight scale the contribution of
+	// each source under RRF and linear fusion. All default to 1 when all are
+	// zero.
+	FTSWeight      float64
+	SemanticWeight float64
+	SparseWeight   float64
+	// Normalization brings the scores of all sources to a comparable scale
+	// before linear fusion: minmax (default) or zscore.
+	Normalization string
+}
+
+func (f Fusion) Validate() error {
+	switch f.Strategy {
+	case "", RRFFusion, LinearFusion, FTSFusion, SemanticFusion, SparseFusion:
+	default:
+		return fmt.Errorf("index: unknown fusion strategy %q", f.Strategy)
+	}
+
+	switch f.Normalization {
+	case "", MinMaxNormalization, ZScoreNormalization:
+	default:
+		return fmt.Errorf("index: unknown score normalization %q", f.Normalization)
+	}
+
+	if f.K < 0 || f.FTSWeight < 0 || f.SemanticWeight < 0 || f.SparseWeight < 0 {
+		return fmt.Errorf("index: fusion k and weights must not be negative")
+	}
+
+	return nil
+}
+
+func (f Fusion) withDefaults() Fusion {
+	if f.Strategy == "" {
+		f.Strategy = RRFFusion
+	}
+	if f.K == 0 {
+		f.K = DefaultRRFK
+	}
+	if f.FTSWeight == 0 && f.SemanticWeight == 0 && f.SparseWeight == 0 {
+		f.FTSWeight, f.SemanticWeight, f.SparseWeight = 1, 1, 1
+	}
+	if f.Normalization == "" {
+		f.Normalization = MinMaxNormalization
+	}
+	return f
+}
+
+type IndexResults struct {
+	FTS      []Match
+	Semantic []Match
+	Sparse   []Match
+}
+
+// MergeCandidates merges the candidates of several memtables and segments
+// into one list per source, best first. A document found in several of them
+// keeps its best match of each source.
+func MergeCandidates(partitions []IndexResults) IndexResults {
+	fts, semantic, sparse := [][]Match{}, [][]Match{}, [][]Match{}
+	for _, p := range partitions {
+		fts = append(fts, p.FTS)
+		semantic = append(semantic, p.Semantic)
+		sparse = append(sparse, p.Sparse)
+	}
+
+	return IndexResults{FTS: dedupe(fts), Semantic: dedupe(semantic), Sparse: dedupe(sparse)}
+}
+
+func dedupe(lists [][]Match) []Match {
+	seen := map[float64]int{}
+	merged := []Match{}
+
+	for _, matches := range lists {
+		for _, m := range matches {
+			if j, ok := seen[m.Offsets[0].DocumentID]; ok {
+				if m.Score > merged[j].Score {
+					merged[j] = m
+				}
+				continue
+			}
+			seen[m.Offsets[0].DocumentID] = len(merged)
+			merged = append(merged, m)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+
+	return merged
+}
+
+// Fuse combines the candidates of q into its k best documents. A search
+// restricted to a single index keeps that index's own scores.
+func Fuse(results IndexResults, q Query, k int) []Match {
+	fusion := q.Fusion
+
+	switch q.SearchMode() {
+	case KeywordMode:
+		fusion.Strategy = FTSFusion
+	case SemanticMode:
+		fusion.Strategy = SemanticFusion
+	case SparseMode:
+		fusion.Strategy = SparseFusion
+	}
+
+	return mergeResult(results, fusion, k)
+}
+
+// mergeResult fuses the results of every source into the k best documents.
+// A document found by several keeps the offsets of its match in the first of
+// full-text, semantic and sparse results, and the passage of its semantic
+// match.
+func mergeResult(results IndexResults, fusion Fusion, k int) []Match {
+	fusion = fusion.withDefaults()
+
+	sources := [][]Match{results.FTS, results.Semantic, results.Sparse}
+	weights := []float64{fusion.FTSWeight, fusion.SemanticWeight, fusion.SparseWeight}
+
+	//a single source strategy ignores the others
+	for s, strategy := range []string{FTSFusion, SemanticFusion, SparseFusion} {
+		if fusion.Strategy == strategy {
+			single := sources[s]
+			sources = make([][]Match, len(sources))
+			sources[s] = single
+		}
+	}
+
+	sourceScores := make([][]float64, len(sources))
+	for s, matches := range sources {
+		switch fusion.Strategy {
+		case RRFFusion:
+			sourceScores[s] = reciprocalRanks(matches, fusion.K, weights[s])
+		case LinearFusion:
+			sourceScores[s] = normalize(matches, fusion.Normalization, weights[s])
+		default:
+			sourceScores[s] = scores(matches)
+		}
+	}
+
+	//documents missing from a source get its lowest score, which is 0 for
+	//every strategy but zscore
+	missing := make([]float64, len(sources))
+	if fusion.Strategy == LinearFusion && fusion.Normalization == ZScoreNormalization {
+		for s := range sources {
+			missing[s] = lowest(sourceScores[s])
+		}
+	}
+
+	seen := map[float64]int{}
+	merged := []Match{}
+	perSource := [][]float64{}
+
+	for s, matches := range sources {
+		for i, r := range matches {
+			j, ok := seen[r.Offsets[0].DocumentID]
+			if !ok {
+				j = len(merged)
+				seen[r.Offsets[0].DocumentID] = j
+				merged = append(merged, Match{Offsets: r.Offsets})
+				perSource = append(perSource, append([]float64{}, missing...))
+			}
+
+			perSource[j][s] = sourceScores[s][i]
+			if merged[j].Passage == nil {
+				merged[j].Passage = r.Passage
+			}
+		}
+	}
+
+	for j := range merged {
+		for _, score := range perSource[j] {
+			merged[j].Score += score
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+
+	k = int(math.Min(float64(k), float64(len(merged))))
+	return merged[:k]
+}
+
+// reciprocalRanks scores the matches of a source by weight/(k+rank), ranks
+// starting at 1.
+func reciprocalRanks(matches []Match, k, weight float64) []float64 {
+	r := make([]float64, len(matches))
+	for rank := range matches {
+		r[rank] = weight / (k + float64(rank) + 1)
+	}
+	return r
+}
+
+// normalize rescales the scores of a source so both sources can be summed.
+// minmax maps them to [0, 1], zscore to their distance from the mean in
+// standard deviations.
+func normalize(matches []Match, normalization string, weight float64) []float64 {
+	r := scores(matches)
+	if len(r) == 0 {
+		return r
+	}
+
+	switch normalization {
+	case ZScoreNormalization:
+		mean, variance := 0., 0.
+		for _, s := range r {
+			mean += s
+		}
+		mean /= float64(len(r))
+
+		for _, s := range r {
+			variance += (s - mean) * (s - mean)
+		}
+		std := math.Sqrt(variance / float64(len(r)))
+
+		for i, s := range r {
+			if std == 0 {
+				r[i] = 0
+			} else {
+				r[i] = weight * (s - mean) / std
+			}
+		}
+	default:
+		lo, hi := r[0], r[0]
+		for _, s := range r {
+			lo, hi = math.Min(lo, s), math.Max(hi, s)
+		}
+
+		for i, s := range r {
+			if hi == lo {
+				r[i] = weight
+			} else {
+				r[i] = weight * (s - lo) / (hi - lo)
+			}
+		}
+	}
+
+	return r
+}
+
+func scores(matches []Match) []float64 {
+	r := make([]float64, len(matches))
+	for i, m := range matches {
+		r[i] = m.Score
+	}
+	return r
+}
+
+func lowest(scores []float64) float64 {
+	if len(scores) == 0 {
+		return 0
+	}
+
+	lo := scores[0]
+	for _, s := range scores {
+		lo = math.Min(lo, s)
+	}
+	return lo
+}
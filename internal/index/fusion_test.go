@@ -0,0 +1,164 @@
+package index
+
+import (
+	"math"
+	"testing"
+)
+
+func matchesOf(docs []float64, scores []float64) []Match {
+	r := []Match{}
+	for i, doc := range docs {
+		r = append(r, Match{Offsets: []Position{{DocumentID: doc}}, Score: scores[i]})
+	}
+	return r
+}
+
+func documentIDs(matches []Match) []float64 {
+	r := []float64{}
+	for _, m := range matches {
+		r = append(r, m.Offsets[0].DocumentID)
+	}
+	return r
+}
+
+func TestMergeResultRRF(t *testing.T) {
+	results := IndexResults{
+		FTS:      matchesOf([]float64{1, 2, 3}, []float64{9, 5, 1}),
+		Semantic: matchesOf([]float64{3, 4, 1}, []float64{0.9, 0.8, 0.1}),
+	}
+
+	merged := mergeResult(results, Fusion{}, 10)
+
+	//1 and 3 are found by both sources, 1 ranks higher overall
+	expected := []float64{1, 3, 2, 4}
+	if got := documentIDs(merged); !equalIDs(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	score := 1./61 + 1./63
+	if math.Abs(merged[0].Score-score) > 1e-12 {
+		t.Fatalf("expected %v, got %v", score, merged[0].Score)
+	}
+
+	//weighting the semantic source brings its rank-1 result first
+	merged = mergeResult(results, Fusion{Strategy: RRFFusion, K: 1, FTSWeight: 0.1, SemanticWeight: 1}, 2)
+	expected = []float64{3, 4}
+	if got := documentIDs(merged); !equalIDs(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestMergeResultLinear(t *testing.T) {
+	results := IndexResults{
+		FTS:      matchesOf([]float64{1, 2}, []float64{40, 20}),
+		Semantic: matchesOf([]float64{2, 3}, []float64{0.9, 0.5}),
+	}
+
+	merged := mergeResult(results, Fusion{Strategy: LinearFusion}, 10)
+
+	//minmax: 1 -> 1, 2 -> 0 + 1, 3 -> 0
+	expected := []float64{1, 2, 3}
+	if got := documentIDs(merged); !equalIDs(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	if merged[1].Score != 1 || merged[2].Score != 0 {
+		t.Fatalf("expected %v, got %v", []float64{1, 1, 0}, merged)
+	}
+
+	//zscore: 1 -> 1 - 1, 2 -> -1 + 1, 3 -> -1 - 1
+	merged = mergeResult(results, Fusion{Strategy: LinearFusion, Normalization: ZScoreNormalization}, 10)
+	if merged[2].Offsets[0].DocumentID != 3 || math.Abs(merged[2].Score+2) > 1e-12 {
+		t.Fatalf("expected %v, got %v", -2, merged)
+	}
+}
+
+func TestMergeResultSingleSource(t *testing.T) {
+	results := IndexResults{
+		FTS:      matchesOf([]float64{1, 2}, []float64{40, 20}),
+		Semantic: matchesOf([]float64{3, 2}, []float64{0.9, 0.5}),
+	}
+
+	if got := documentIDs(mergeResult(results, Fusion{Strategy: FTSFusion}, 10)); !equalIDs(got, []float64{1, 2}) {
+		t.Fatalf("expected %v, got %v", []float64{1, 2}, got)
+	}
+
+	if got := documentIDs(mergeResult(results, Fusion{Strategy: SemanticFusion}, 10)); !equalIDs(got, []float64{3, 2}) {
+		t.Fatalf("expected %v, got %v", []float64{3, 2}, got)
+	}
+}
+
+func TestFusionValidate(t *testing.T) {
+	for _, f := range []Fusion{{Strategy: "max"}, {Normalization: "l2"}, {K: -1}} {
+		if f.Validate() == nil {
+			t.Fatalf("expected %+v to be invalid", f)
+		}
+	}
+
+	if err := (Fusion{Strategy: LinearFusion, Normalization: ZScoreNormalization}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func equalIDs(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMergeCandidates(t *testing.T) {
+	partitions := []IndexResults{
+		{FTS: matchesOf([]float64{1, 2}, []float64{0.4, 0.2}), Semantic: matchesOf([]float64{1}, []float64{0.9})},
+		{FTS: matchesOf([]float64{2, 3}, []float64{0.8, 0.1}), Semantic: matchesOf([]float64{1, 3}, []float64{0.5, 0.7})},
+	}
+
+	merged := MergeCandidates(partitions)
+
+	if ids := documentIDs(merged.FTS); !equalIDs(ids, []float64{2, 1, 3}) || merged.FTS[0].Score != 0.8 {
+		t.Fatalf("expected %v, got %v", []float64{2, 1, 3}, merged.FTS)
+	}
+
+	if ids := documentIDs(merged.Semantic); !equalIDs(ids, []float64{1, 3}) || merged.Semantic[0].Score != 0.9 {
+		t.Fatalf("expected %v, got %v", []float64{1, 3}, merged.Semantic)
+	}
+
+	fused := Fuse(merged, Query{Text: "q", Mode: KeywordMode}, 2)
+	if ids := documentIDs(fused); !equalIDs(ids, []float64{2, 1}) {
+		t.Fatalf("expected %v, got %v", []float64{2, 1}, ids)
+	}
+}
+
+func TestMergeResultSparse(t *testing.T) {
+	results := IndexResults{
+		FTS:      matchesOf([]float64{1, 2}, []float64{9, 5}),
+		Semantic: matchesOf([]float64{2, 1}, []float64{0.9, 0.8}),
+		Sparse:   matchesOf([]float64{3, 2}, []float64{4, 1}),
+	}
+
+	//2 is found by all three sources
+	merged := mergeResult(results, Fusion{}, 10)
+	if got := documentIDs(merged); !equalIDs(got, []float64{2, 1, 3}) {
+		t.Fatalf("expected %v, got %v", []float64{2, 1, 3}, got)
+	}
+
+	score := 1./62 + 1./61 + 1./62
+	if math.Abs(merged[0].Score-score) > 1e-12 {
+		t.Fatalf("expected %v, got %v", score, merged[0].Score)
+	}
+
+	if got := documentIDs(mergeResult(results, Fusion{Strategy: SparseFusion}, 10)); !equalIDs(got, []float64{3, 2}) {
+		t.Fatalf("expected %v, got %v", []float64{3, 2}, got)
+	}
+
+	//without a sparse weight the sparse source is ignored
+	merged = mergeResult(results, Fusion{FTSWeight: 1, SemanticWeight: 1}, 10)
+	if got := documentIDs(merged); merged[2].Score != 0 || got[2] != 3 {
+		t.Fatalf("expected document %v to score %v, got %v", 3, 0, merged)
+	}
+}
@@ -0,0 +1,290 @@
+package index
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/farouqzaib/fast-search/internal/analyzer"
+)
+
+const (
+	// DefaultFragmentSize is the approximate length in bytes of a highlighted
+	// fragment.
+	DefaultFragmentSize = 150
+	// DefaultMaxFragments is the number of fragments returned for a document.
+	DefaultMaxFragments = 3
+)
+
+// Highlighter cuts fragments out of a document around the terms of a query
+// and wraps every matched term in <em> tags.
+type Highlighter struct {
+	analyzer     *analyzer.Analyzer
+	FragmentSize int
+	MaxFragments int
+}
+
+// Highlight holds the fragments of a document and the character range of the
+// best cover, which is -1 when it could not be located.
+type Highlight struct {
+	Fragments []string
+	Start     int
+	End       int
+}
+
+type span struct {
+	start int
+	end   int
+}
+
+func NewHighlighter(a *analyzer.Analyzer) *Highlighter {
+	return &Highlighter{analyzer: a, FragmentSize: DefaultFragmentSize, MaxFragments: DefaultMaxFragments}
+}
+
+// Highlight returns the fragments of document matching query. offsets is the
+// cover of a match: when the index stores character offsets only the
+// fragment around the cover is analyzed, otherwise the whole document is
+// re-analyzed to locate the cover and every other match.
+func (h *Highlighter) Highlight(document, query string, offsets []Position) Highlight {
+	if cover := storedCover(document, offsets); cover != nil {
+		return h.highlightCover(document, query, *cover)
+	}
+
+	a := h.analyzer
+	if lang := a.DetectLanguage(document); lang != "" {
+		a = a.ForLanguage(lang)
+	}
+
+	tokens := a.Tokens(document)
+	terms := []queryTerm{}
+	for _, variant := range parseQuery(a, query) {
+		terms = append(terms, variant...)
+	}
+
+	matches := matchTokens(tokens, terms)
+	cover := locateCover(tokens, offsets)
+
+	highlight := Highlight{Fragments: []string{}, Start: -1, End: -1}
+	if cover != nil {
+		highlight.Start, highlight.End = cover.start, cover.end
+	}
+
+	//the cover comes first, then the remaining matches in document order
+	anchors := matches
+	if cover != nil {
+		anchors = append([]span{*cover}, matches...)
+	}
+
+	covered := []span{}
+	for _, anchor := range anchors {
+		if len(highlight.Fragments) >= h.MaxFragments {
+			break
+		}
+
+		if overlaps(covered, anchor) {
+			continue
+		}
+
+		fragment := h.fragment(document, anchor)
+		covered = append(covered, fragment)
+		highlight.Fragments = append(highlight.Fragments, markup(document, fragment, matches))
+	}
+
+	return highlight
+}
+
+// highlightCover returns the single fragment around a cover located by its
+// stored character offsets, analyzing nothing but that fragment.
+func (h *Highlighter) highlightCover(document, query string, cover span) Highlight {
+	fragment := h.fragment(document, cover)
+	text := document[fragment.start:fragment.end]
+
+	a := h.analyzer
+	if lang := a.DetectLanguage(text); lang != "" {
+		a = a.ForLanguage(lang)
+	}
+
+	terms := []queryTerm{}
+	for _, variant := range parseQuery(a, query) {
+		terms = append(terms, variant...)
+	}
+
+	//token offsets are relative to the fragment
+	matches := matchTokens(a.Tokens(text), terms)
+	for j := range matches {
+		matches[j].start += fragment.start
+		matches[j].end += fragment.start
+	}
+
+	return Highlight{
+		Fragments: []string{markup(document, fragment, matches)},
+		Start:     cover.start,
+		End:       cover.end,
+	}
+}
+
+// matchTokens returns the character spans of the tokens matching a query
+// term. Exact terms missing from the document fall back to a fuzzy match,
+// as they do when searching.
+func matchTokens(tokens []analyzer.Token, terms []queryTerm) []span {
+	present := map[string]bool{}
+	for _, token := range tokens {
+		present[token.Term] = true
+	}
+
+	spans := []span{}
+	for _, token := range tokens {
+		for _, term := range terms {
+			if matchTerm(term, token.Term, present) {
+				spans = append(spans, span{start: token.Start, end: token.End})
+				break
+			}
+		}
+	}
+
+	return spans
+}
+
+func matchTerm(term queryTerm, token string, present map[string]bool) bool {
+	switch term.kind {
+	case wildcardTerm:
+		return matchWildcard(term.text, token)
+	case fuzzyTerm:
+		return matchFuzzy(term.text, token, term.distance)
+	default:
+		if present[term.text] {
+			return term.text == token
+		}
+		return matchFuzzy(term.text, token, autoFuzziness(term.text))
+	}
+}
+
+func matchFuzzy(term, token string, maxEdits int) bool {
+	automaton := newLevenshteinAutomaton(term, maxEdits)
+
+	state := automaton.start()
+	for _, r := range token {
+		state = automaton.step(state, r)
+		if !automaton.canMatch(state) {
+			return false
+		}
+	}
+
+	return automaton.isMatch(state)
+}
+
+// storedCover returns the character offsets stored with a cover, or nil if
+// the index did not store them or they do not fit document.
+func storedCover(document string, offsets []Position) *span {
+	if len(offsets) != 2 || math.IsInf(offsets[0].Offset, 0) || math.IsInf(offsets[1].Offset, 0) {
+		return nil
+	}
+
+	start, end := offsets[0].Start, offsets[1].End
+	if end <= 0 || start > end || end > len(document) {
+		return nil
+	}
+
+	return &span{start: start, end: end}
+}
+
+// locateCover converts the token positions of a cover to character offsets.
+func locateCover(tokens []analyzer.Token, offsets []Position) *span {
+	if len(offsets) != 2 || math.IsInf(offsets[0].Offset, 0) || math.IsInf(offsets[1].Offset, 0) {
+		return nil
+	}
+
+	cover := span{start: -1, end: -1}
+	for _, token := range tokens {
+		if token.Position == offsets[0].GetOffset() && cover.start < 0 {
+			cover.start = token.Start
+		}
+		if token.Position == offsets[1].GetOffset() {
+			cover.end = token.End
+		}
+	}
+
+	if cover.start < 0 || cover.end < cover.start {
+		return nil
+	}
+
+	return &cover
+}
+
+// fragment grows s to roughly FragmentSize bytes, centred on s and cut at
+// word boundaries.
+func (h *Highlighter) fragment(document string, s span) span {
+	padding := (h.FragmentSize - (s.end - s.start)) / 2
+	if padding < 0 {
+		padding = 0
+	}
+
+	start := s.start - padding
+	if start < 0 {
+		start = 0
+	}
+
+	end := s.end + padding
+	if end > len(document) {
+		end = len(document)
+	}
+
+	for start > 0 && !isBoundary(document, start) {
+		start--
+	}
+
+	for end < len(document) && !isBoundary(document, end) {
+		end++
+	}
+
+	return span{start: start, end: end}
+}
+
+func isBoundary(document string, i int) bool {
+	if !utf8.RuneStart(document[i]) {
+		return false
+	}
+
+	r, _ := utf8.DecodeRuneInString(document[i:])
+	return unicode.IsSpace(r)
+}
+
+func overlaps(spans []span, s span) bool {
+	for _, other := range spans {
+		if s.start < other.end && other.start < s.end {
+			return true
+		}
+	}
+	return false
+}
+
+// markup escapes the fragment of document and wraps the matches inside it.
+func markup(document string, fragment span, matches []span) string {
+	//the caller may be iterating over matches, sort a copy
+	matches = append([]span{}, matches...)
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].start < matches[j].start
+	})
+
+	var b strings.Builder
+	last := fragment.start
+
+	for _, m := range matches {
+		if m.start < last || m.end > fragment.end {
+			continue
+		}
+
+		b.WriteString(html.EscapeString(document[last:m.start]))
+		b.WriteString("<em>")
+		b.WriteString(html.EscapeString(document[m.start:m.end]))
+		b.WriteString("</em>")
+		last = m.end
+	}
+
+	b.WriteString(html.EscapeString(document[last:fragment.end]))
+
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,97 @@
+package index
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/farouqzaib/fast-search/internal/analyzer"
+)
+
+func TestHighlighterHighlight(t *testing.T) {
+	index := NewInvertedIndex()
+	document := "Batman is saving Gotham & its <people> from the Joker"
+	index.Index(1, document)
+
+	matches := index.RankProximity("saving gotham", 10)
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %v", matches)
+	}
+
+	expected := Highlight{
+		Fragments: []string{"Batman is <em>saving</em> <em>Gotham</em> &amp; its &lt;people&gt; from the Joker"},
+		Start:     10,
+		End:       23,
+	}
+
+	got := NewHighlighter(analyzer.Default()).Highlight(document, "saving gotham", matches[0].Offsets)
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestHighlighterStoredOffsets(t *testing.T) {
+	index := NewInvertedIndex()
+	index.StoreOffsets = true
+	document := "Batman is saving Gotham"
+	index.Index(1, document)
+
+	matches := index.RankProximity("batman gotham", 10)
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %v", matches)
+	}
+
+	expected := []int{0, 23}
+
+	got := NewHighlighter(analyzer.Default()).Highlight(document, "batman gotham", matches[0].Offsets)
+
+	if got.Start != expected[0] || got.End != expected[1] {
+		t.Fatalf("expected %v, got %v", expected, []int{got.Start, got.End})
+	}
+}
+
+func TestHighlighterStoredOffsetsFragment(t *testing.T) {
+	index := NewInvertedIndex()
+	index.StoreOffsets = true
+	document := strings.Repeat("nothing happens here. ", 20) + "batman arrives in gotham."
+	index.Index(1, document)
+
+	matches := index.RankProximity("batman gotham", 10)
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %v", matches)
+	}
+
+	highlighter := NewHighlighter(analyzer.Default())
+	highlighter.FragmentSize = 40
+
+	//only the fragment around the stored cover is analyzed and returned
+	got := highlighter.Highlight(document, "batman gotham", matches[0].Offsets)
+
+	expected := "<em>batman</em> arrives in <em>gotham</em>."
+	if len(got.Fragments) != 1 || !strings.HasSuffix(got.Fragments[0], expected) {
+		t.Fatalf("expected %v, got %v", expected, got.Fragments)
+	}
+
+	if got.End != len(document)-1 {
+		t.Fatalf("expected %v, got %v", len(document)-1, got.End)
+	}
+}
+
+func TestHighlighterFragments(t *testing.T) {
+	document := "gotham is dark. " + strings.Repeat("nothing happens here. ", 20) + "batman arrives in gotham."
+
+	highlighter := NewHighlighter(analyzer.Default())
+	highlighter.FragmentSize = 40
+
+	got := highlighter.Highlight(document, "gotham", nil)
+
+	if len(got.Fragments) != 2 {
+		t.Fatalf("expected 2 fragments, got %v", got.Fragments)
+	}
+
+	expected := "batman arrives in <em>gotham</em>."
+	if !strings.HasSuffix(got.Fragments[1], expected) {
+		t.Fatalf("expected %v, got %v", expected, got.Fragments[1])
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/gob"
 	"math"
 	"math/rand"
+	"sort"
 )
 
 type maxHeap []Candidate
@@ -53,8 +54,12 @@ func (h *minHeap) Pop() any {
 }
 
 type VectorNode struct {
-	Vector  []float64
-	ID      int
+	Vector []float64
+	ID     int
+	// Start and End are the byte range of the chunk of document ID the
+	// vector stands for, both 0 when it stands for the whole document.
+	Start   int
+	End     int
 	Indices []int
 	Entry   int
 }
@@ -74,6 +79,9 @@ type HNSW struct {
 	M     int
 	EFC   int
 	Index []Graph
+	// positions maps document ids to the positions of their nodes in the
+	// bottom layer, so their vectors are found without scanning it.
+	positions map[int][]int
 }
 
 func NewHNSW(L int, mL float64, m int, efc int) *HNSW {
@@ -167,18 +175,31 @@ func (hnsw *HNSW) Search(query VectorNode, ef int) []Match {
 	for _, graph := range hnsw.Index {
 		nn := hnsw.searchLayer(graph, bestNode, query, 1)[0]
 		bestNode = nn.Entry
-		if graph.Elements[bestNode].Entry > 0 {
+		//entry is the position of the node in the layer below, -1 in the bottom layer
+		if graph.Elements[bestNode].Entry >= 0 {
 			bestNode = graph.Elements[bestNode].Entry
 		} else {
 			neighbours := hnsw.searchLayer(graph, bestNode, query, ef)
+
+			//the heap keeps the farthest neighbour first, rank the nearest first
+			sort.Slice(neighbours, func(i, j int) bool {
+				return neighbours[i].Distance < neighbours[j].Distance
+			})
+
+			//scores are cosine similarities so that, like every other score,
+			//higher is better
+			//a document indexed in chunks may be returned once per chunk
 			result := []Match{}
 			for _, neighbour := range neighbours {
-				result = append(result,
-					Match{
-						Offsets: []Position{{DocumentID: float64(hnsw.Index[len(hnsw.Index)-1].Elements[neighbour.Entry].ID)}},
-						Score:   neighbour.Distance,
-					},
-				)
+				node := hnsw.Index[len(hnsw.Index)-1].Elements[neighbour.Entry]
+				match := Match{
+					Offsets: []Position{{DocumentID: float64(node.ID)}},
+					Score:   1 - neighbour.Distance,
+				}
+				if node.End > 0 {
+					match.Passage = &Passage{Start: node.Start, End: node.End}
+				}
+				result = append(result, match)
 			}
 			return result
 		}
@@ -186,6 +207,52 @@ func (hnsw *HNSW) Search(query VectorNode, ef int) []Match {
 	return []Match{}
 }
 
+// Dimensions returns the size of the vectors in the index, 0 when it is
+// empty.
+func (hnsw *HNSW) Dimensions() int {
+	elements := hnsw.Index[len(hnsw.Index)-1].Elements
+	if len(elements) == 0 {
+		return 0
+	}
+	return len(elements[0].Vector)
+}
+
+// Vectors returns the vectors of the documents in ids found in the index.
+// A document indexed in chunks is represented by the mean of their vectors.
+func (hnsw *HNSW) Vectors(ids map[int]bool) map[int][]float64 {
+	elements := hnsw.Index[len(hnsw.Index)-1].Elements
+
+	vectors := map[int][]float64{}
+	for id := range ids {
+		positions := hnsw.positions[id]
+		if len(positions) == 0 {
+			continue
+		}
+
+		sum := make([]float64, len(elements[positions[0]].Vector))
+		for _, position := range positions {
+			for i := range sum {
+				sum[i] += elements[position].Vector[i]
+			}
+		}
+		for i := range sum {
+			sum[i] /= float64(len(positions))
+		}
+		vectors[id] = sum
+	}
+
+	return vectors
+}
+
+// addPosition records that the node of document id sits at position in the
+// bottom layer.
+func (hnsw *HNSW) addPosition(id int, position int) {
+	if hnsw.positions == nil {
+		hnsw.positions = map[int][]int{}
+	}
+	hnsw.positions[id] = append(hnsw.positions[id], position)
+}
+
 func (hnsw *HNSW) getInsertLayer() int {
 	l := -math.Log(rand.Float64()) * hnsw.mL
 	return int(math.Min(l, float64(hnsw.L-1)))
@@ -196,9 +263,10 @@ func (hnsw *HNSW) insert(vec VectorNode) {
 		i := -1
 		for n := len(hnsw.Index) - 1; n >= 0; n-- {
 			vec.Entry = i
-			hnsw.Index[n] = Graph{Elements: []VectorNode{{ID: vec.ID, Vector: vec.Vector, Entry: i}}}
+			hnsw.Index[n] = Graph{Elements: []VectorNode{{ID: vec.ID, Vector: vec.Vector, Start: vec.Start, End: vec.End, Entry: i}}}
 			i = 0
 		}
+		hnsw.positions = map[int][]int{vec.ID: {0}}
 		return
 	}
 
@@ -212,7 +280,7 @@ func (hnsw *HNSW) insert(vec VectorNode) {
 			if i < hnsw.L-1 {
 				entry = len(hnsw.Index[i+1].Elements)
 			}
-			node := VectorNode{Vector: vec.Vector, Indices: []int{}, Entry: entry, ID: vec.ID}
+			node := VectorNode{Vector: vec.Vector, Indices: []int{}, Entry: entry, ID: vec.ID, Start: vec.Start, End: vec.End}
 
 			nearestNeighbours := hnsw.searchLayer(hnsw.Index[i], startingNode, vec, hnsw.EFC)
 
@@ -228,6 +296,9 @@ func (hnsw *HNSW) insert(vec VectorNode) {
 					len(hnsw.Index[i].Elements),
 				)
 			}
+			if i == len(hnsw.Index)-1 {
+				hnsw.addPosition(vec.ID, len(hnsw.Index[i].Elements))
+			}
 			hnsw.Index[i].Elements = append(hnsw.Index[i].Elements, node)
 		}
 		startingNode = hnsw.Index[i].Elements[startingNode].Entry
@@ -254,5 +325,11 @@ func (h *HNSW) Decode(b []byte) error {
 		return err
 	}
 
+	//positions are not encoded, rebuild them from the bottom layer
+	h.positions = nil
+	for position, node := range h.Index[len(h.Index)-1].Elements {
+		h.addPosition(node.ID, position)
+	}
+
 	return nil
 }
@@ -56,3 +56,19 @@ func TestHNSW(t *testing.T) {
 	// }
 	// fmt.Println("decoded index:", q.Search(randomPoint(), 10))
 }
+
+func TestHNSWSearchEntryZero(t *testing.T) {
+	//the only node of the top layer is the first of the bottom layer
+	hnsw := NewHNSW(2, 0.62, 2, 10)
+	hnsw.Index[0] = Graph{Elements: []VectorNode{{ID: 1, Vector: []float64{1, 0}, Indices: []int{}, Entry: 0}}}
+	hnsw.Index[1] = Graph{Elements: []VectorNode{
+		{ID: 1, Vector: []float64{1, 0}, Indices: []int{1}, Entry: -1},
+		{ID: 2, Vector: []float64{0, 1}, Indices: []int{0}, Entry: -1},
+	}}
+
+	matches := hnsw.Search(VectorNode{Vector: []float64{0, 1}}, 10)
+
+	if len(matches) != 2 || matches[0].Offsets[0].DocumentID != 2 {
+		t.Fatalf("expected %v first of %v matches, got %v", 2, 2, matches)
+	}
+}
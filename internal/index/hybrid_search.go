@@ -1,165 +1,413 @@
 package index
 
 import (
-	"bytes"
-	"encoding/json"
-	"io"
+	"context"
+	"fmt"
 	"log/slog"
 	"math"
-	"net/http"
-	"os"
-	"sort"
+	"sync"
+
+	"github.com/farouqzaib/fast-search/internal/chunking"
+	"github.com/farouqzaib/fast-search/internal/embedding"
+)
+
+const (
+	// DefaultBatchSize is the number of documents embedded per request when
+	// bulk indexing.
+	DefaultBatchSize = 32
+	// DefaultBulkWorkers is the number of embedding requests in flight when
+	// bulk indexing.
+	DefaultBulkWorkers = 4
+	// DefaultCandidates is the least number of matches taken from each index
+	// before fusion.
+	DefaultCandidates = 64
 )
 
-type TextEmbeddingResponse struct {
-	Status string    `json:"status"`
-	Data   []float64 `json:"data"`
+type HybridSearch struct {
+	FTS       *InvertedIndex
+	Semantic  *HNSW
+	BatchSize int
+	Workers   int
+	// Chunker cuts documents into passages embedded separately, documents
+	// are embedded whole when it is nil.
+	Chunker chunking.Chunker
+	// Sparse indexes the sparse vectors of documents, which are dropped
+	// when it is nil. SparseEmbedder computes those not given, only
+	// documents bringing theirs have one when it is nil.
+	Sparse         *SparseIndex
+	SparseEmbedder embedding.SparseEmbedder
+	logger         *slog.Logger
+	embedder       embedding.Embedder
 }
 
-type TextEmbeddingRequest struct {
-	Text string `json:"text"`
+func NewHybridSearch(fts *InvertedIndex, semantic *HNSW, logger *slog.Logger, embedder embedding.Embedder) *HybridSearch {
+	return &HybridSearch{
+		FTS:      fts,
+		Semantic: semantic,
+		logger:   logger,
+		embedder: embedder,
+	}
 }
 
-type IndexResults struct {
-	FTS      []Match
-	Semantic []Match
+const (
+	// KeywordMode only searches the inverted index, so the query is never
+	// embedded.
+	KeywordMode = "keyword"
+	// SemanticMode only searches the vector index.
+	SemanticMode = "semantic"
+	// SparseMode only searches the sparse vector index.
+	SparseMode = "sparse"
+	// HybridMode searches every index and fuses their results.
+	HybridMode = "hybrid"
+)
+
+// Query is matched against the inverted index by its text, against the
+// vector index by its vector and against the sparse index by its sparse
+// vector.
+type Query struct {
+	Text   string
+	Vector []float64
+	Sparse SparseVector
+	// Mode selects the indexes searched. It defaults to the single index
+	// of an fts, semantic or sparse fusion, and to hybrid otherwise.
+	Mode string
+	// Fusion combines the results of both indexes, RRF by default.
+	Fusion Fusion
+	// MMR diversifies the fused results when it is not nil.
+	MMR *MMR
 }
 
-type HybridSearch struct {
-	FTS          *InvertedIndex
-	Semantic     *HNSW
-	logger       *slog.Logger
-	getEmbedding getEmbeddingFn
+// SearchMode returns the mode of q with its default applied.
+func (q Query) SearchMode() string {
+	if q.Mode != "" {
+		return q.Mode
+	}
+
+	switch q.Fusion.Strategy {
+	case FTSFusion:
+		return KeywordMode
+	case SemanticFusion:
+		return SemanticMode
+	case SparseFusion:
+		return SparseMode
+	default:
+		return HybridMode
+	}
 }
 
-func NewHybridSearch(fts *InvertedIndex, semantic *HNSW, logger *slog.Logger, getEmbedding getEmbeddingFn) *HybridSearch {
-	return &HybridSearch{
-		FTS:          fts,
-		Semantic:     semantic,
-		getEmbedding: getEmbedding,
+func (q Query) Validate() error {
+	switch q.Mode {
+	case "", KeywordMode, SemanticMode, SparseMode, HybridMode:
+	default:
+		return fmt.Errorf("index: unknown search mode %q", q.Mode)
+	}
+
+	if q.SearchMode() == KeywordMode && q.Text == "" {
+		return fmt.Errorf("index: a keyword search needs a query text")
+	}
+
+	if q.SearchMode() == SparseMode && q.Text == "" && q.Sparse == nil {
+		return fmt.Errorf("index: a sparse search needs a query text or a sparse vector")
+	}
+
+	if q.Text == "" && q.Vector == nil && q.Sparse == nil {
+		return fmt.Errorf("index: a search needs a query text or a vector")
+	}
+
+	if q.MMR != nil {
+		if err := q.MMR.Validate(); err != nil {
+			return err
+		}
 	}
+
+	return q.Fusion.Validate()
 }
 
-func (hs *HybridSearch) Index(docId int, document string) error {
-	vector, err := hs.getEmbedding(document)
+// Index adds a document to every index. vector and sparse are used as is
+// when given, otherwise every chunk of the document is embedded and so is the
+// whole document for the sparse index. Documents without text only go to the
+// vector indexes.
+func (hs *HybridSearch) Index(ctx context.Context, docId int, document string, vector []float64, sparse SparseVector) error {
+	sparses, err := hs.embedSparse(ctx, []string{document}, []SparseVector{sparse})
 	if err != nil {
 		return err
 	}
+	sparse = sparses[0]
 
-	hs.FTS.Index(docId, document)
-	hs.Semantic.Create([]VectorNode{{Vector: vector, ID: docId}})
+	if vector != nil {
+		hs.index(docId, document, []VectorNode{{ID: docId, Vector: vector}}, sparse)
+		return nil
+	}
+
+	//a document embedded whole is a single text
+	if hs.Chunker == nil {
+		vector, err := hs.embedder.Embed(ctx, document)
+		if err != nil {
+			return err
+		}
+		hs.index(docId, document, []VectorNode{{ID: docId, Vector: vector}}, sparse)
+		return nil
+	}
+
+	chunks := hs.chunks(document)
+	texts := []string{}
+	for _, c := range chunks {
+		texts = append(texts, c.Text)
+	}
+
+	vectors, err := hs.embedder.EmbedBatch(ctx, texts)
+	if err != nil {
+		return err
+	}
+
+	nodes := []VectorNode{}
+	for j, c := range chunks {
+		nodes = append(nodes, VectorNode{ID: docId, Vector: vectors[j], Start: c.Start, End: c.End})
+	}
+	hs.index(docId, document, nodes, sparse)
 
 	return nil
 }
 
-func (hs *HybridSearch) BulkIndex(docIds []float64, documents []string) error {
-	jobsCh := make(chan map[int]string, len(docIds))
-	resultsCh := make(chan int, len(docIds))
-
-	//TODO: make number of workers configurable
-	for worker := 0; worker < 8; worker++ {
-		slog.Info("bulk indexing: worker", slog.Int("worker", worker))
-		go func(jobs chan map[int]string) {
-			for job := range jobs {
-				for docId, document := range job {
-					vector, err := hs.getEmbedding(document)
-					if err != nil {
-						slog.Error("bulk indexing error:", err)
-						panic(err)
-					}
-
-					hs.FTS.Index(docId, document)
-					hs.Semantic.Create([]VectorNode{{Vector: vector, ID: docId}})
-
-					resultsCh <- 1
-				}
-			}
-		}(jobsCh)
+// chunks returns the chunks of document, a single chunk spanning nothing,
+// so standing for the whole document, without a Chunker or words.
+func (hs *HybridSearch) chunks(document string) []chunking.Chunk {
+	if hs.Chunker != nil {
+		if chunks := hs.Chunker.Chunk(document); len(chunks) > 0 {
+			return chunks
+		}
 	}
+	return []chunking.Chunk{{Text: document}}
+}
 
-	//send tasks to goroutines
-	for i := 0; i < len(docIds); i++ {
-		jobsCh <- map[int]string{int(docIds[i]): documents[i]}
+func (hs *HybridSearch) index(docId int, document string, nodes []VectorNode, sparse SparseVector) {
+	if document != "" {
+		hs.FTS.Index(docId, document)
 	}
+	hs.Semantic.Create(nodes)
+	if hs.Sparse != nil && sparse != nil {
+		hs.Sparse.Index(docId, sparse)
+	}
+}
 
-	//process results
-	for k := 0; k < len(docIds); k++ {
-		<-resultsCh
+// embedSparse fills in the sparse vectors missing from sparse, one per
+// document, in batches of BatchSize. Without a sparse index or embedder
+// sparse is returned as is.
+func (hs *HybridSearch) embedSparse(ctx context.Context, documents []string, sparse []SparseVector) ([]SparseVector, error) {
+	if sparse == nil {
+		sparse = make([]SparseVector, len(documents))
 	}
-	return nil
+
+	if hs.Sparse == nil || hs.SparseEmbedder == nil {
+		return sparse, nil
+	}
+
+	pending := []int{}
+	for i, document := range documents {
+		if sparse[i] == nil && document != "" {
+			pending = append(pending, i)
+		}
+	}
+
+	batchSize := hs.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	for start := 0; start < len(pending); start += batchSize {
+		end := int(math.Min(float64(start+batchSize), float64(len(pending))))
+
+		texts := []string{}
+		for _, i := range pending[start:end] {
+			texts = append(texts, documents[i])
+		}
+
+		vectors, err := hs.SparseEmbedder.EmbedSparse(ctx, texts)
+		if err != nil {
+			return nil, err
+		}
+
+		for j, i := range pending[start:end] {
+			sparse[i] = vectors[j]
+		}
+	}
+
+	return sparse, nil
 }
 
-func (hs *HybridSearch) Search(query string, k int) ([]Match, error) {
-	ftsResult := hs.FTS.RankProximity(query, k)
+// BulkIndex embeds the chunks of documents in batches of BatchSize, with at
+// most Workers batches in flight. Batches are only handed out as workers free
+// up and workers wait for their vectors to be indexed, so a slow embedding
+// service or index holds the whole pipeline back instead of queueing every
+// document. Documents are indexed in a single goroutine, once all their chunks
+// are embedded, since neither index can be written concurrently. vectors is
+// either nil or holds the precomputed vector of each document, nil for the
+// documents to embed, and sparse their sparse vectors likewise.
+func (hs *HybridSearch) BulkIndex(ctx context.Context, docIds []float64, documents []string, vectors [][]float64, sparse []SparseVector) error {
+	if len(docIds) != len(documents) {
+		return fmt.Errorf("bulk indexing: %d ids for %d documents", len(docIds), len(documents))
+	}
+
+	if vectors != nil && len(vectors) != len(documents) {
+		return fmt.Errorf("bulk indexing: %d vectors for %d documents", len(vectors), len(documents))
+	}
+
+	if sparse != nil && len(sparse) != len(documents) {
+		return fmt.Errorf("bulk indexing: %d sparse vectors for %d documents", len(sparse), len(documents))
+	}
 
-	vector, err := hs.getEmbedding(query)
+	sparse, err := hs.embedSparse(ctx, documents, sparse)
 	if err != nil {
-		return []Match{}, err
+		return fmt.Errorf("bulk indexing: %w", err)
 	}
-	semanticResult := hs.Semantic.Search(VectorNode{Vector: vector}, 64)
 
-	return mergeResult(IndexResults{FTS: ftsResult, Semantic: semanticResult}, k), nil
-}
+	//documents bringing their own vector skip the embedder
+	pending := []pendingChunk{}
+	chunkCounts := map[int]int{}
+	for i := range documents {
+		if vectors != nil && vectors[i] != nil {
+			hs.index(int(docIds[i]), documents[i], []VectorNode{{ID: int(docIds[i]), Vector: vectors[i]}}, sparse[i])
+			continue
+		}
 
-func mergeResult(results IndexResults, k int) []Match {
-	mergedResults := []Match{}
+		chunks := hs.chunks(documents[i])
+		for _, c := range chunks {
+			pending = append(pending, pendingChunk{document: i, chunk: c})
+		}
+		chunkCounts[i] = len(chunks)
+	}
 
-	seen := map[string]Match{}
-	for rank, r := range results.FTS {
-		matchID, _ := r.GetKey()
-		reciprocalRank := 1.1 / (float64(rank) + 1.)
-		seen[matchID] = Match{Offsets: r.Offsets, Score: reciprocalRank}
+	batchSize, workers := hs.BatchSize, hs.Workers
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if workers <= 0 {
+		workers = DefaultBulkWorkers
 	}
 
-	for rank, r := range results.Semantic {
-		matchID, _ := r.GetKey()
-		reciprocalRank := 1. / (float64(rank) + 1.)
+	//returning early cancels the embedding requests still in flight
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-		val, ok := seen[matchID]
-		if ok {
-			val.Score += reciprocalRank
-			seen[matchID] = val
-		} else {
-			seen[matchID] = Match{Offsets: r.Offsets, Score: reciprocalRank}
+	batchesCh := make(chan embeddingBatch)
+	resultsCh := make(chan embeddingBatch, workers)
+
+	//send batches to workers as they free up
+	go func() {
+		defer close(batchesCh)
+		for start := 0; start < len(pending); start += batchSize {
+			end := int(math.Min(float64(start+batchSize), float64(len(pending))))
+			select {
+			case batchesCh <- embeddingBatch{start: start, end: end}:
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batchesCh {
+				texts := []string{}
+				for _, p := range pending[batch.start:batch.end] {
+					texts = append(texts, p.chunk.Text)
+				}
+				batch.vectors, batch.err = hs.embedBatch(ctx, texts)
+				select {
+				case resultsCh <- batch:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
 	}
 
-	for _, v := range seen {
-		mergedResults = append(mergedResults, v)
+	go func() {
+		wg.Wait()
+		close(resultsCh)
+	}()
+
+	//process results, the chunks of a document may arrive in several batches
+	nodes := map[int][]VectorNode{}
+	for batch := range resultsCh {
+		if batch.err != nil {
+			return fmt.Errorf("bulk indexing: documents %d to %d: %w", pending[batch.start].document, pending[batch.end-1].document, batch.err)
+		}
+
+		for i, vector := range batch.vectors {
+			p := pending[batch.start+i]
+			docId := int(docIds[p.document])
+			nodes[p.document] = append(nodes[p.document], VectorNode{ID: docId, Vector: vector, Start: p.chunk.Start, End: p.chunk.End})
+
+			if len(nodes[p.document]) == chunkCounts[p.document] {
+				hs.index(docId, documents[p.document], nodes[p.document], sparse[p.document])
+				delete(nodes, p.document)
+			}
+		}
 	}
 
-	sort.Slice(mergedResults, func(i, j int) bool {
-		return mergedResults[i].Score > mergedResults[j].Score
-	})
+	return nil
+}
 
-	k = int(math.Min(float64(k), float64(len(mergedResults))))
-	return mergedResults[:k]
+// embedBatch embeds texts, turning a panic of the embedder into an error so
+// a bulk index worker fails its request rather than the whole server.
+func (hs *HybridSearch) embedBatch(ctx context.Context, texts []string) (vectors [][]float64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("embedder panicked: %v", r)
+		}
+	}()
+
+	return hs.embedder.EmbedBatch(ctx, texts)
 }
 
-type getEmbeddingFn func(text string) ([]float64, error)
+// pendingChunk is a chunk of the document at index document of a bulk index
+// request waiting for its vector.
+type pendingChunk struct {
+	document int
+	chunk    chunking.Chunk
+}
 
-func GetEmbedding(text string) ([]float64, error) {
-	embeddingHost := os.Getenv("EmbeddingHost")
-	postBody, _ := json.Marshal(map[string]string{
-		"text": text,
-	})
-	responseBody := bytes.NewBuffer(postBody)
-	resp, err := http.Post(embeddingHost, "application/json", responseBody)
-	if err != nil {
-		return nil, err
-	}
+type embeddingBatch struct {
+	start   int
+	end     int
+	vectors [][]float64
+	err     error
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+// Search fuses the results of the text of q in the inverted index, of its
+// vector in the vector index and of its sparse vector in the sparse index.
+// The query is not embedded here, so it is embedded once for every index
+// searched: each index is only searched when q has what it matches.
+func (hs *HybridSearch) Search(q Query, k int) ([]Match, error) {
+	return Fuse(hs.Candidates(q, k, hs.FTS), q, k), nil
+}
+
+// Candidates returns the raw results of q in each index, best first and
+// unfused, so the candidates of several memtables and segments can be merged
+// before fusing them once. Each index returns at least DefaultCandidates
+// matches, since a document ranked low by one source can still win overall.
+// Full-text scores are weighted by the idf of terms in stats.
+func (hs *HybridSearch) Candidates(q Query, k int, stats Statistics) IndexResults {
+	mode := q.SearchMode()
+	depth := int(math.Max(float64(k), DefaultCandidates))
+
+	results := IndexResults{FTS: []Match{}, Semantic: []Match{}, Sparse: []Match{}}
+	if (mode == HybridMode || mode == KeywordMode) && q.Text != "" {
+		results.FTS = hs.FTS.RankProximityWith(q.Text, depth, stats)
 	}
 
-	var embedding TextEmbeddingResponse
+	//chunk hits are aggregated into document hits scored by their best chunk
+	if (mode == HybridMode || mode == SemanticMode) && q.Vector != nil {
+		results.Semantic = dedupe([][]Match{hs.Semantic.Search(VectorNode{Vector: q.Vector}, depth)})
+	}
 
-	err = json.Unmarshal(body, &embedding)
-	if err != nil {
-		return nil, err
+	if (mode == HybridMode || mode == SparseMode) && q.Sparse != nil && hs.Sparse != nil {
+		results.Sparse = hs.Sparse.Search(q.Sparse, depth)
 	}
 
-	return embedding.Data, nil
+	return results
 }
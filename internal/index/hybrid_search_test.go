@@ -1,33 +1,210 @@
 package index
 
 import (
-	"reflect"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/farouqzaib/fast-search/internal/chunking"
+	"github.com/farouqzaib/fast-search/internal/embedding"
 )
 
-func TestHybridSearchReciprocalRank(t *testing.T) {
+type countingEmbedder struct {
+	embedding.Embedder
+	mu       sync.Mutex
+	batches  []int
+	failText string
+}
+
+func (c *countingEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	c.mu.Lock()
+	c.batches = append(c.batches, len(texts))
+	c.mu.Unlock()
+
+	for _, text := range texts {
+		if text == c.failText {
+			return nil, errors.New("service unavailable")
+		}
+	}
+
+	return c.Embedder.EmbedBatch(ctx, texts)
+}
+
+func TestHybridSearchBulkIndex(t *testing.T) {
+	embedder := &countingEmbedder{Embedder: embedding.NewHashing(32)}
+	h := NewHybridSearch(NewInvertedIndex(), NewHNSW(5, 0.62, 2, 16), nil, embedder)
+	h.BatchSize, h.Workers = 4, 2
+
+	docIds, documents := []float64{}, []string{}
+	for i := 0; i < 10; i++ {
+		docIds = append(docIds, float64(i))
+		documents = append(documents, fmt.Sprintf("document number %d", i))
+	}
+
+	err := h.BulkIndex(context.Background(), docIds, documents, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(embedder.batches) != 3 {
+		t.Fatalf("expected %v, got %v", 3, len(embedder.batches))
+	}
+
+	vectors := h.Semantic.Index[len(h.Semantic.Index)-1].Elements
+	if len(vectors) != 10 {
+		t.Fatalf("expected %v, got %v", 10, len(vectors))
+	}
+
+	if len(h.FTS.RankProximity("document", 20)) != 10 {
+		t.Fatalf("expected %v documents to be indexed", 10)
+	}
+}
+
+func TestHybridSearchBulkIndexError(t *testing.T) {
+	embedder := &countingEmbedder{Embedder: embedding.NewHashing(32), failText: "document number 5"}
+	h := NewHybridSearch(NewInvertedIndex(), NewHNSW(5, 0.62, 2, 16), nil, embedder)
+	h.BatchSize, h.Workers = 2, 2
+
+	docIds, documents := []float64{}, []string{}
+	for i := 0; i < 100; i++ {
+		docIds = append(docIds, float64(i))
+		documents = append(documents, fmt.Sprintf("document number %d", i))
+	}
+
+	err := h.BulkIndex(context.Background(), docIds, documents, nil, nil)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if err := h.BulkIndex(context.Background(), docIds[:2], documents[:1], nil, nil); err == nil {
+		t.Fatalf("expected an error for mismatched ids and documents")
+	}
+}
+
+type panickingEmbedder struct {
+	embedding.Embedder
+}
+
+func (panickingEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	panic("malformed response")
+}
+
+func TestHybridSearchBulkIndexPanic(t *testing.T) {
+	h := NewHybridSearch(NewInvertedIndex(), NewHNSW(5, 0.62, 2, 16), nil, panickingEmbedder{embedding.NewHashing(8)})
+	h.BatchSize, h.Workers = 2, 2
+
+	err := h.BulkIndex(context.Background(), []float64{1, 2, 3}, []string{"a", "b", "c"}, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "malformed response") {
+		t.Fatalf("expected the panic as an error, got %v", err)
+	}
+}
+
+func TestHybridSearchVectors(t *testing.T) {
+	embedder := &countingEmbedder{Embedder: embedding.NewHashing(4)}
+	h := NewHybridSearch(NewInvertedIndex(), NewHNSW(5, 0.62, 2, 16), nil, embedder)
+
+	err := h.BulkIndex(context.Background(),
+		[]float64{1, 2, 3},
+		[]string{"", "raft consensus", "vector only"},
+		[][]float64{{1, 0, 0, 0}, nil, {0, 1, 0, 0}},
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//only the document without a vector is embedded
+	if len(embedder.batches) != 1 || embedder.batches[0] != 1 {
+		t.Fatalf("expected %v, got %v", []int{1}, embedder.batches)
+	}
+
+	err = h.Index(context.Background(), 4, "", []float64{0, 0, 1, 0}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(h.FTS.RankProximity("vector", 10)) != 1 {
+		t.Fatalf("expected %v, got %v", 1, len(h.FTS.RankProximity("vector", 10)))
+	}
+
+	matches, err := h.Search(Query{Vector: []float64{1, 0, 0, 0}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) != 1 || matches[0].Offsets[0].DocumentID != 1 {
+		t.Fatalf("expected %v, got %v", 1, matches)
+	}
+
+	if h.Semantic.Dimensions() != 4 {
+		t.Fatalf("expected %v, got %v", 4, h.Semantic.Dimensions())
+	}
+}
+
+func TestHybridSearchModes(t *testing.T) {
+	h := NewHybridSearch(NewInvertedIndex(), NewHNSW(5, 0.62, 2, 16), nil, embedding.NewHashing(4))
+
+	h.Index(context.Background(), 1, "raft consensus", []float64{1, 0, 0, 0}, nil)
+	h.Index(context.Background(), 2, "paxos", []float64{0, 1, 0, 0}, nil)
+
+	q := Query{Text: "raft", Vector: []float64{0, 1, 0, 0}}
+
+	for mode, expected := range map[string][]float64{KeywordMode: {1}, SemanticMode: {2, 1}} {
+		q.Mode = mode
+		matches, _ := h.Search(q, 10)
+		if got := documentIDs(matches); !equalIDs(got, expected) {
+			t.Fatalf("%s: expected %v, got %v", mode, expected, got)
+		}
+	}
 
-	searchResults := IndexResults{
-		FTS: []Match{
-			{Offsets: []Position{{DocumentID: 1, Offset: 2}, {DocumentID: 1, Offset: 3}}, Score: 0.20},
-			{Offsets: []Position{{DocumentID: 2, Offset: 3}, {DocumentID: 2, Offset: 4}}, Score: 0.50},
-			{Offsets: []Position{{DocumentID: 3, Offset: 5}, {DocumentID: 3, Offset: 6}}, Score: 0.20},
-		},
-		Semantic: []Match{
-			{Offsets: []Position{{DocumentID: 1, Offset: 0}, {DocumentID: 1, Offset: 0}}, Score: 0.80},
-			{Offsets: []Position{{DocumentID: 4, Offset: 0}, {DocumentID: 4, Offset: 0}}, Score: 0.61},
-			{Offsets: []Position{{DocumentID: 9, Offset: 0}, {DocumentID: 9, Offset: 0}}, Score: 0.01},
-		},
+	q.Mode = HybridMode
+	matches, _ := h.Search(q, 10)
+	if len(matches) != 2 {
+		t.Fatalf("expected %v, got %v", 2, len(matches))
 	}
 
-	expected := []Match{
-		{Offsets: []Position{{DocumentID: 1, Offset: 2}, {DocumentID: 1, Offset: 3}}, Score: 2.1},
-		{Offsets: []Position{{DocumentID: 2, Offset: 3}, {DocumentID: 2, Offset: 4}}, Score: 0.55},
+	if (Query{Fusion: Fusion{Strategy: FTSFusion}}).SearchMode() != KeywordMode {
+		t.Fatalf("expected an fts fusion to imply a keyword search")
 	}
 
-	got := mergeResult(searchResults, 2)
+	if (Query{Vector: []float64{1}, Mode: KeywordMode}).Validate() == nil {
+		t.Fatalf("expected a keyword search without text to be invalid")
+	}
+}
+
+func TestHybridSearchChunks(t *testing.T) {
+	embedder := &countingEmbedder{Embedder: embedding.NewHashing(64)}
+	h := NewHybridSearch(NewInvertedIndex(), NewHNSW(5, 0.62, 2, 16), nil, embedder)
+	h.Chunker = chunking.NewTokens(3)
+	h.BatchSize = 2
+
+	document := "batman saves gotham alfred serves tea joker tells jokes"
+	if err := h.Index(context.Background(), 1, document, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	docIds := []float64{2, 3}
+	documents := []string{"robin drives the batmobile fast", "commissioner gordon lights signal"}
+	if err := h.BulkIndex(context.Background(), docIds, documents, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(h.Semantic.Index[len(h.Semantic.Index)-1].Elements); n != 7 {
+		t.Fatalf("expected %v chunks, got %v", 7, n)
+	}
+
+	vector, _ := embedding.NewHashing(64).Embed(context.Background(), "alfred serves tea")
+	matches, _ := h.Search(Query{Vector: vector}, 10)
+
+	if len(matches) != 3 || matches[0].Offsets[0].DocumentID != 1 {
+		t.Fatalf("expected document 1 first and once, got %v", matches)
+	}
 
-	if !reflect.DeepEqual(got, expected) {
-		t.Fatalf("expected %v, got %v", expected, got)
+	passage := matches[0].Passage
+	if passage == nil || document[passage.Start:passage.End] != "alfred serves tea" {
+		t.Fatalf("expected %q, got %v", "alfred serves tea", passage)
 	}
 }
@@ -10,41 +10,195 @@ import (
 	"fmt"
 	"log/slog"
 	"math"
-	"strings"
+	"sort"
 	"sync"
 
 	"github.com/farouqzaib/fast-search/internal/analyzer"
 )
 
 type InvertedIndex struct {
-	mu           sync.Mutex
-	PostingsList map[string]SkipList
+	mu            sync.Mutex
+	PostingsList  map[string]SkipList
+	Dictionary    TermDictionary
+	Completion    Completion
+	MaxExpansions int
+	// Languages holds the detected language of every document when the
+	// analyzer detects languages.
+	Languages map[int]string
+	// StoreOffsets keeps the character offsets of every token in its postings
+	// so matches can be highlighted without re-analyzing whole documents.
+	StoreOffsets bool
+	languages    map[string]int
+	documents    map[int]struct{}
+	analyzer     *analyzer.Analyzer
 }
 
 func NewInvertedIndex() *InvertedIndex {
 	postingsList := map[string]SkipList{}
 	return &InvertedIndex{
 		PostingsList: postingsList,
+		Completion:   *NewCompletion(),
 	}
 }
 
+// SetAnalyzer sets the analyzer used for both documents and queries.
+func (i *InvertedIndex) SetAnalyzer(a *analyzer.Analyzer) {
+	i.analyzer = a
+}
+
+// Analyzer returns the analyzer of the index, which is the default analyzer
+// unless one has been set.
+func (i *InvertedIndex) Analyzer() *analyzer.Analyzer {
+	if i.analyzer == nil {
+		return analyzer.Default()
+	}
+	return i.analyzer
+}
+
 func (i *InvertedIndex) Index(docID int, document string) {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 	slog.Info("index: indexing documents", slog.Int("docID", docID))
-	tokens := analyzer.Analyze(document)
+	a := i.Analyzer()
+	if lang := a.DetectLanguage(document); lang != "" {
+		i.addLanguage(docID, lang)
+		a = a.ForLanguage(lang)
+	}
+
+	tokens := a.Tokens(document)
+
+	if i.documents == nil {
+		i.documents = map[int]struct{}{}
+	}
+	i.documents[docID] = struct{}{}
 
-	for j, word := range tokens {
+	//token positions keep the gaps left by removed stopwords, so "tower of
+	//london" and "tower london" stay distinguishable
+	for _, token := range tokens {
+		word := token.Term
 		_, ok := i.PostingsList[word]
 
 		if !ok {
 			i.PostingsList[word] = *NewSkipList()
+			i.Dictionary.Add(word)
+		}
+
+		position := Position{DocumentID: float64(docID), Offset: float64(token.Position)}
+		if i.StoreOffsets {
+			position.Start, position.End = token.Start, token.End
 		}
 
 		sk := i.PostingsList[word]
-		sk.Insert(Position{DocumentID: float64(docID), Offset: float64(j)})
+		sk.Insert(position)
 		i.PostingsList[word] = sk
 	}
+
+	i.Completion.Add(a.Words(document))
+}
+
+// dominantLanguage returns the language most documents of indexes are in, or
+// an empty string if no language was detected.
+func dominantLanguage(indexes ...*InvertedIndex) string {
+	counts := map[string]int{}
+	for _, i := range indexes {
+		for lang, n := range i.languages {
+			counts[lang] += n
+		}
+	}
+
+	dominant := ""
+	for lang, n := range counts {
+		if n > counts[dominant] || (n == counts[dominant] && lang < dominant) {
+			dominant = lang
+		}
+	}
+
+	return dominant
+}
+
+// queryAnalyzer returns the analyzer for query. Short queries are analyzed in
+// the language of most documents rather than detected.
+func (i *InvertedIndex) queryAnalyzer(query string) *analyzer.Analyzer {
+	a := i.Analyzer()
+	if lang := a.QueryLanguage(query, dominantLanguage(i)); lang != "" {
+		return a.ForLanguage(lang)
+	}
+	return a
+}
+
+func (i *InvertedIndex) addLanguage(docID int, lang string) {
+	if i.Languages == nil {
+		i.Languages = map[int]string{}
+	}
+	if i.languages == nil {
+		i.languages = map[string]int{}
+	}
+
+	i.Languages[docID] = lang
+	i.languages[lang]++
+}
+
+// Metadata records how the documents of an index were analyzed, so a segment
+// is searched the same way once it is reloaded.
+type Metadata struct {
+	Analyzer      analyzer.Config `json:"analyzer"`
+	Normalization string          `json:"normalization,omitempty"`
+	Stopwords     string          `json:"stopwords,omitempty"`
+	Languages     map[int]string  `json:"languages,omitempty"`
+}
+
+func (i *InvertedIndex) Metadata() Metadata {
+	a := i.Analyzer()
+	return Metadata{
+		Analyzer:      a.Config(),
+		Normalization: a.Normalization(),
+		Stopwords:     a.StopwordsFingerprint(),
+		Languages:     i.Languages,
+	}
+}
+
+// SetMetadata restores the languages of the documents of a reloaded segment.
+// The analyzer is not restored: it is shared with the documents and queries
+// of the whole index, so a segment analyzed differently is reported by its
+// storage instead and must be reindexed.
+func (i *InvertedIndex) SetMetadata(m Metadata) {
+	i.Languages = nil
+	i.languages = nil
+	for docID, lang := range m.Languages {
+		i.addLanguage(docID, lang)
+	}
+}
+
+func (m Metadata) Encode() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m *Metadata) Decode(b []byte) error {
+	return json.Unmarshal(b, m)
+}
+
+// DocumentCount returns the number of documents in the index.
+func (i *InvertedIndex) DocumentCount() int {
+	return len(i.documents)
+}
+
+// DocumentFrequency returns the number of documents containing token.
+func (i *InvertedIndex) DocumentFrequency(token string) int {
+	sk, ok := i.PostingsList[token]
+	if !ok {
+		return 0
+	}
+
+	frequency := 0
+	last := BOF
+	for node := sk.Head.Tower[0]; node != nil; node = node.Tower[0] {
+		if node.Key.DocumentID != last {
+			frequency++
+			last = node.Key.DocumentID
+		}
+	}
+
+	return frequency
 }
 
 func (i *InvertedIndex) First(token string) (Position, error) {
@@ -108,31 +262,114 @@ func (i *InvertedIndex) Previous(token string, offset Position) (Position, error
 	return Position{DocumentID: BOF, Offset: BOF}, errors.New("no list exists for token")
 }
 
+// nextAny returns the smallest position after offset across every term, which
+// is the next position of their unioned postings.
+func (i *InvertedIndex) nextAny(terms []weightedTerm, offset Position) Position {
+	next := Position{DocumentID: EOF, Offset: EOF}
+
+	for _, t := range terms {
+		p, _ := i.Next(t.term, offset)
+		if p.DocumentID < next.DocumentID || (p.DocumentID == next.DocumentID && p.Offset < next.Offset) {
+			next = p
+		}
+	}
+
+	return next
+}
+
+// previousAny returns the largest position before offset across every term
+// along with the weight of the term found there.
+func (i *InvertedIndex) previousAny(terms []weightedTerm, offset Position) (Position, float64) {
+	previous := Position{DocumentID: BOF, Offset: BOF}
+	weight := 0.
+
+	for _, t := range terms {
+		p, _ := i.Previous(t.term, offset)
+		if p.DocumentID > previous.DocumentID || (p.DocumentID == previous.DocumentID && p.Offset > previous.Offset) {
+			previous = p
+			weight = t.weight
+		}
+	}
+
+	return previous, weight
+}
+
+// NextPhrase returns the first and last positions of the next exact
+// occurrence of query after offset.
 func (i *InvertedIndex) NextPhrase(query string, offset Position) []Position {
+	return i.NextSloppyPhrase(query, 0, offset)
+}
+
+// NextSloppyPhrase returns the first and last positions of the next
+// occurrence of query after offset. The query is analyzed like documents, so
+// the gaps left by removed stopwords must be matched as well. With a slop of
+// 0 every term must sit at its exact relative position; otherwise the terms
+// must appear in order within a span at most slop positions longer or
+// shorter than that of the query. Every synonym variant of the query is
+// tried and the earliest occurrence wins. A query too short for its language
+// to be detected is analyzed in the language of most documents.
+func (i *InvertedIndex) NextSloppyPhrase(query string, slop int, offset Position) []Position {
+	next := []Position{{DocumentID: EOF, Offset: EOF}, {DocumentID: EOF, Offset: EOF}}
+
+	for _, tokens := range i.queryAnalyzer(query).QueryVariants(query) {
+		if len(tokens) == 0 {
+			continue
+		}
+
+		positions := i.nextPhrase(tokens, slop, offset)
+		u := positions[0]
+		if u.DocumentID < next[0].DocumentID || (u.DocumentID == next[0].DocumentID && u.Offset < next[0].Offset) {
+			next = positions
+		}
+	}
+
+	return next
+}
+
+func (i *InvertedIndex) nextPhrase(tokens []analyzer.Token, slop int, offset Position) []Position {
 	v := offset
 
-	terms := strings.Fields(query)
-	for _, char := range terms {
-		word := string(char)
-		v, _ = i.Next(word, v)
+	for _, token := range tokens {
+		v, _ = i.Next(token.Term, v)
 	}
 
 	if v.Offset == EOF {
 		return []Position{{DocumentID: EOF, Offset: EOF}, {DocumentID: EOF, Offset: EOF}}
 	}
 
+	positions := make([]Position, len(tokens))
+	positions[len(tokens)-1] = v
 	u := v
 
-	for j := len(terms) - 2; j >= 0; j-- {
-		word := terms[j]
-		u, _ = i.Previous(word, u)
+	for j := len(tokens) - 2; j >= 0; j-- {
+		u, _ = i.Previous(tokens[j].Term, u)
+		positions[j] = u
 	}
 
-	if (v.DocumentID == u.DocumentID) && (v.GetOffset()-u.GetOffset() == len(strings.Fields(query))-1) {
+	if v.DocumentID == u.DocumentID && matchesPhrase(tokens, positions, slop) {
 		return []Position{u, v}
 	}
 
-	return i.NextPhrase(query, u)
+	return i.nextPhrase(tokens, slop, u)
+}
+
+func matchesPhrase(tokens []analyzer.Token, positions []Position, slop int) bool {
+	first := tokens[0].Position
+	start := positions[0].GetOffset()
+
+	if slop == 0 {
+		for j, token := range tokens {
+			if positions[j].GetOffset()-start != token.Position-first {
+				return false
+			}
+		}
+		return true
+	}
+
+	span := positions[len(positions)-1].GetOffset() - start
+	expected := tokens[len(tokens)-1].Position - first
+
+	return span-expected <= slop && expected-span <= slop
 }
 
 func (i *InvertedIndex) FindAllPhrases(query string, offset Position) [][]Position {
@@ -153,10 +390,23 @@ func (i *InvertedIndex) FindAllPhrases(query string, offset Position) [][]Positi
 }
 
 func (i *InvertedIndex) NextCover(tokens []string, offset Position) []Position {
+	terms := make([][]weightedTerm, len(tokens))
+	for j, token := range tokens {
+		terms[j] = []weightedTerm{{term: token, weight: 1}}
+	}
+
+	cover, _ := i.nextCover(terms, offset)
+	return cover
+}
+
+// nextCover finds the next cover where each entry of terms is a set of
+// alternatives, any one of which satisfies that query term. It also returns
+// the product of the weights of the alternatives making up the cover.
+func (i *InvertedIndex) nextCover(terms [][]weightedTerm, offset Position) ([]Position, float64) {
 	v := offset
 
-	for j, word := range tokens {
-		localMax, _ := i.Next(word, offset)
+	for j, alternatives := range terms {
+		localMax := i.nextAny(alternatives, offset)
 
 		//break if localMax is ever EOF
 		if localMax.DocumentID == EOF {
@@ -175,13 +425,15 @@ func (i *InvertedIndex) NextCover(tokens []string, offset Position) []Position {
 	}
 
 	if v.DocumentID == EOF {
-		return []Position{{DocumentID: EOF, Offset: EOF}, {DocumentID: EOF, Offset: EOF}}
+		return []Position{{DocumentID: EOF, Offset: EOF}, {DocumentID: EOF, Offset: EOF}}, 0
 	}
 
 	u := Position{DocumentID: BOF, Offset: BOF}
+	weight := 1.
 
-	for j, word := range tokens {
-		localMin, _ := i.Previous(word, Position{DocumentID: v.DocumentID, Offset: v.Offset + 1})
+	for j, alternatives := range terms {
+		localMin, w := i.previousAny(alternatives, Position{DocumentID: v.DocumentID, Offset: v.Offset + 1})
+		weight *= w
 
 		if j == 0 {
 			u = localMin
@@ -194,15 +446,23 @@ func (i *InvertedIndex) NextCover(tokens []string, offset Position) []Position {
 	}
 
 	if u.DocumentID == v.DocumentID {
-		return []Position{u, v}
+		return []Position{u, v}, weight
 	}
 
-	return i.NextCover(tokens, u)
+	return i.nextCover(terms, u)
 }
 
 type Match struct {
 	Offsets []Position
 	Score   float64
+	// Passage is the best matching chunk of a document indexed in chunks.
+	Passage *Passage
+}
+
+// Passage is the byte range of a chunk of a document.
+type Passage struct {
+	Start int
+	End   int
 }
 
 func (m *Match) GetKey() (string, error) {
@@ -220,15 +480,87 @@ func (m *Match) GetKey() (string, error) {
 	return val, nil
 }
 
+// RankProximity returns the k best matches of query, weighting terms by the
+// statistics of the index itself.
 func (i *InvertedIndex) RankProximity(query string, k int) []Match {
+	return i.RankProximityWith(query, k, i)
+}
+
+// RankProximityWith returns the k best matches of query by proximity score,
+// weighting every term of a cover by its idf in stats.
+func (i *InvertedIndex) RankProximityWith(query string, k int, stats Statistics) []Match {
 	slog.Info("index: proximity ranking")
-	tokens := analyzer.Analyze(query)
-	slog.Info("index: search tokens", slog.String("tokens", fmt.Sprintf("%v", tokens)))
-	if len(tokens) == 0 {
+
+	results := []Match{}
+	if len(i.languages) == 0 {
+		results = i.rankProximity(i.Analyzer(), query, nil, stats)
+	}
+
+	//documents are only matched by the query analyzed in their own language
+	for lang := range i.languages {
+		inLanguage := func(docID float64) bool {
+			return i.Languages[int(docID)] == lang
+		}
+		results = append(results, i.rankProximity(i.Analyzer().ForLanguage(lang), query, inLanguage, stats)...)
+	}
+
+	//ties keep document order so truncating is deterministic
+	sort.SliceStable(results, func(a, b int) bool {
+		if results[a].Score != results[b].Score {
+			return results[a].Score > results[b].Score
+		}
+		return results[a].Offsets[0].DocumentID < results[b].Offsets[0].DocumentID
+	})
+
+	return results[:int(math.Min(float64(k), float64(len(results))))]
+}
+
+// rankProximity scores every document matched by query, in document order,
+// skipping those rejected by keep when it is not nil. A document matched by
+// several variants of the query keeps its best score.
+func (i *InvertedIndex) rankProximity(a *analyzer.Analyzer, query string, keep func(docID float64) bool, stats Statistics) []Match {
+	best := map[float64]Match{}
+
+	for _, variant := range parseQuery(a, query) {
+		for _, match := range i.rankVariant(weighTerms(i.expandQuery(variant, stats), stats), keep) {
+			docID := match.Offsets[0].DocumentID
+			if m, ok := best[docID]; !ok || match.Score > m.Score {
+				best[docID] = match
+			}
+		}
+	}
+
+	results := make([]Match, 0, len(best))
+	for _, match := range best {
+		results = append(results, match)
+	}
+
+	sort.Slice(results, func(a, b int) bool {
+		return results[a].Offsets[0].DocumentID < results[b].Offsets[0].DocumentID
+	})
+
+	return results
+}
+
+// weighTerms scales the weight of every alternative by its idf, so covers
+// of rare terms outscore equally tight covers of common ones.
+func weighTerms(terms [][]weightedTerm, stats Statistics) [][]weightedTerm {
+	n := stats.DocumentCount()
+	for _, alternatives := range terms {
+		for j := range alternatives {
+			alternatives[j].weight *= idf(n, stats.DocumentFrequency(alternatives[j].term))
+		}
+	}
+	return terms
+}
+
+func (i *InvertedIndex) rankVariant(terms [][]weightedTerm, keep func(docID float64) bool) []Match {
+	slog.Info("index: search tokens", slog.String("tokens", fmt.Sprintf("%v", terms)))
+	if len(terms) == 0 {
 		return []Match{}
 	}
 
-	offsets := i.NextCover(tokens, Position{DocumentID: BOF, Offset: BOF})
+	offsets, weight := i.nextCover(terms, Position{DocumentID: BOF, Offset: BOF})
 	u, v := offsets[0], offsets[1]
 	candidate := []Position{u, v}
 	score := 0.0
@@ -236,26 +568,40 @@ func (i *InvertedIndex) RankProximity(query string, k int) []Match {
 
 	for u.DocumentID < EOF {
 		if candidate[0].DocumentID < u.DocumentID {
-			results = append(results, Match{Offsets: candidate, Score: score})
+			if keep == nil || keep(candidate[0].DocumentID) {
+				results = append(results, Match{Offsets: candidate, Score: score})
+			}
 			candidate = []Position{u, v}
 			score = 0
 		}
 
-		score = score + 1/(v.Offset-u.Offset+1)
+		score = score + weight/(v.Offset-u.Offset+1)
 
-		offsets = i.NextCover(tokens, u)
+		offsets, weight = i.nextCover(terms, u)
 		u, v = offsets[0], offsets[1]
 	}
 
-	if candidate[0].DocumentID < EOF {
+	if candidate[0].DocumentID < EOF && (keep == nil || keep(candidate[0].DocumentID)) {
 		results = append(results, Match{Offsets: candidate, Score: score})
 	}
 
-	return results[:int(math.Min(float64(k), float64(len(results))))]
+	return results
 }
 
+// offsetsHeader marks an encoded index whose postings carry character
+// offsets. No term is long enough to be confused with it.
+const (
+	offsetsHeader uint32 = math.MaxUint32
+	offsetsFlag   uint32 = 1
+)
+
 func (i *InvertedIndex) Encode() ([]byte, error) {
 	b := new(bytes.Buffer)
+	if i.StoreOffsets {
+		binary.Write(b, binary.LittleEndian, offsetsHeader)
+		binary.Write(b, binary.LittleEndian, offsetsFlag)
+	}
+
 	// termList := []string{}
 	for k, v := range i.PostingsList {
 
@@ -297,6 +643,14 @@ func (i *InvertedIndex) Encode() ([]byte, error) {
 				return nil, err
 			}
 
+			if i.StoreOffsets {
+				err = binary.Write(nodeBytes, binary.LittleEndian, [2]uint32{uint32(head.Key.Start), uint32(head.Key.End)})
+
+				if err != nil {
+					return nil, err
+				}
+			}
+
 			head = head.Tower[0]
 
 		}
@@ -363,9 +717,22 @@ func (i *InvertedIndex) Encode() ([]byte, error) {
 
 func (i *InvertedIndex) Decode(b []byte) error {
 	recoveredIndex := map[string]SkipList{}
+	documents := map[int]struct{}{}
 
 	offset := 0
 	round := 0
+
+	//every node is a document id and a position, followed by its character
+	//offsets when they are stored
+	fields := 2
+	storeOffsets := len(b) >= 8 && binary.LittleEndian.Uint32(b[0:4]) == offsetsHeader
+	if storeOffsets {
+		if binary.LittleEndian.Uint32(b[4:8])&offsetsFlag != 0 {
+			fields = 4
+		}
+		offset = 8
+	}
+
 	for offset < len(b) {
 		// fmt.Println("len", len(b.Bytes()))
 		n := int(binary.LittleEndian.Uint32(b[offset : offset+4]))
@@ -392,10 +759,22 @@ func (i *InvertedIndex) Decode(b []byte) error {
 		for i := 0; i < int(un)/4; i++ {
 			node := binary.LittleEndian.Uint32(b[offset : offset+4])
 
-			if i%2 == 0 {
+			switch i % fields {
+			case 0:
 				positions = append(positions, &Node{Key: Position{DocumentID: float64(node)}})
-			} else {
+				//the first node is the head of the skip list
+				if len(positions) > 1 {
+					documents[int(node)] = struct{}{}
+				}
+			case 1:
 				positions[len(positions)-1].Key.Offset = float64(node)
+			case 2:
+				positions[len(positions)-1].Key.Start = int(node)
+			case 3:
+				positions[len(positions)-1].Key.End = int(node)
+			}
+
+			if i%fields == fields-1 {
 				positionMap[counter] = positions[len(positions)-1]
 				counter++
 			}
@@ -404,7 +783,7 @@ func (i *InvertedIndex) Decode(b []byte) error {
 
 		height := 1.0
 		//loop for each of the nodes found
-		for i := 1; i <= int(un)/8; i++ {
+		for i := 1; i <= int(un)/(4*fields); i++ {
 			//get length of node tower keys
 			kn := binary.LittleEndian.Uint32(b[offset : offset+4])
 			// fmt.Println("len node keys", kn)
@@ -434,6 +813,14 @@ func (i *InvertedIndex) Decode(b []byte) error {
 		round++
 	}
 
+	terms := make([]string, 0, len(recoveredIndex))
+	for term := range recoveredIndex {
+		terms = append(terms, term)
+	}
+
 	i.PostingsList = recoveredIndex
+	i.documents = documents
+	i.Dictionary.Set(terms)
+	i.StoreOffsets = fields == 4
 	return nil
 }
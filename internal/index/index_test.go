@@ -1,7 +1,9 @@
 package index
 
 import (
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/farouqzaib/fast-search/internal/analyzer"
@@ -128,3 +130,311 @@ func TestInvertedIndexRankProximity(t *testing.T) {
 		t.Fatalf("expected %v, document offset, got %v", expected, got)
 	}
 }
+
+func TestInvertedIndexRankProximityWildcard(t *testing.T) {
+	index := NewInvertedIndex()
+
+	index.Index(1, "replacement part AB1234 in stock")
+	index.Index(2, "part AB1299 is discontinued")
+	index.Index(3, "part AC5500 ships tomorrow")
+
+	got := index.RankProximity("part ab12*", 10)
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 matches, got %v", got)
+	}
+
+	for _, match := range got {
+		if match.Offsets[0].DocumentID == 3 {
+			t.Fatalf("expected document 3 not to match, got %v", got)
+		}
+	}
+}
+
+func TestInvertedIndexDecodeDictionary(t *testing.T) {
+	index := NewInvertedIndex()
+
+	index.Index(1, "hello, my name is BATMAN!")
+	index.Index(2, "I have come to save Gotham!")
+
+	b, err := index.Encode()
+	if err != nil {
+		t.Fatalf("index encode returned an error")
+	}
+
+	var reloadedIndex InvertedIndex
+	reloadedIndex.Decode(b)
+
+	expected := []string{"gotham"}
+	got := reloadedIndex.Dictionary.Expand("got*", 10)
+
+	if len(got) != 1 || got[0] != expected[0] {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestInvertedIndexDecodeOffsets(t *testing.T) {
+	index := NewInvertedIndex()
+	index.StoreOffsets = true
+
+	index.Index(1, "hello, my name is BATMAN!")
+	index.Index(2, "I have come to save Gotham!")
+
+	b, err := index.Encode()
+	if err != nil {
+		t.Fatalf("index encode returned an error")
+	}
+
+	var reloadedIndex InvertedIndex
+	reloadedIndex.Decode(b)
+
+	if !reloadedIndex.StoreOffsets {
+		t.Fatalf("expected decoded index to store offsets")
+	}
+
+	expected := Position{DocumentID: 2, Offset: 5, Start: 20, End: 26}
+	got, err := reloadedIndex.Next("gotham", Position{DocumentID: BOF, Offset: BOF})
+
+	if err != nil || got != expected {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestInvertedIndexRankProximityFuzzy(t *testing.T) {
+	index := NewInvertedIndex()
+
+	index.Index(1, "hello, my name is BATMAN!")
+	index.Index(2, "I have come to save Gotham!")
+
+	got := index.RankProximity("gotam~1", 10)
+
+	if len(got) != 1 || got[0].Offsets[0].DocumentID != 2 {
+		t.Fatalf("expected document 2 to match, got %v", got)
+	}
+
+	if got[0].Score >= 1 {
+		t.Fatalf("expected fuzzy match to be penalised, got score %v", got[0].Score)
+	}
+}
+
+func TestInvertedIndexRankProximityFuzzyFallback(t *testing.T) {
+	index := NewInvertedIndex()
+
+	index.Index(1, "hello, my name is BATMAN!")
+	index.Index(2, "I have come to save Gotham!")
+
+	got := index.RankProximity("save gohtam", 10)
+
+	if len(got) != 1 || got[0].Offsets[0].DocumentID != 2 {
+		t.Fatalf("expected document 2 to match, got %v", got)
+	}
+}
+
+func TestInvertedIndexRankProximityMultilingual(t *testing.T) {
+	config := analyzer.DefaultConfig()
+	config.Language = analyzer.AutoLanguage
+
+	a, err := analyzer.New(config)
+	if err != nil {
+		t.Fatalf("analyzer returned an error: %v", err)
+	}
+
+	index := NewInvertedIndex()
+	index.SetAnalyzer(a)
+
+	index.Index(1, "Les chats regardent les oiseaux dans le jardin")
+	index.Index(2, "The dog is sleeping in the garden while the cats play")
+
+	if index.Languages[1] != "fr" || index.Languages[2] != "en" {
+		t.Fatalf("expected documents to be detected as fr and en, got %v", index.Languages)
+	}
+
+	got := index.RankProximity("chats jardin", 10)
+
+	if len(got) != 1 || got[0].Offsets[0].DocumentID != 1 {
+		t.Fatalf("expected document 1 to match, got %v", got)
+	}
+}
+
+func TestInvertedIndexShortQueryLanguage(t *testing.T) {
+	config := analyzer.DefaultConfig()
+	config.Language = analyzer.AutoLanguage
+
+	a, err := analyzer.New(config)
+	if err != nil {
+		t.Fatalf("analyzer returned an error: %v", err)
+	}
+
+	index := NewInvertedIndex()
+	index.SetAnalyzer(a)
+	index.Index(1, "Nous avons un jardin fleuri derrière la maison, la famille est heureuse")
+
+	//two words are too few to detect french, the documents' language is used
+	got := index.NextPhrase("jardin fleuri", Position{DocumentID: BOF, Offset: BOF})
+
+	if got[0].DocumentID != 1 {
+		t.Fatalf("expected document 1 to match, got %v", got)
+	}
+
+	suggestions := NewSuggester(a, []*InvertedIndex{index}).Suggest("famille heureuse", 3)
+	if len(suggestions) != 0 {
+		t.Fatalf("expected no suggestions, got %v", suggestions)
+	}
+}
+
+func TestInvertedIndexRankProximityCJK(t *testing.T) {
+	index := NewInvertedIndex()
+
+	index.Index(1, "我喜欢学习编程语言")
+	index.Index(2, "今天天气很好")
+	index.Index(3, "東京タワーに行きました")
+
+	got := index.RankProximity("编程", 10)
+
+	if len(got) != 1 || got[0].Offsets[0].DocumentID != 1 {
+		t.Fatalf("expected document 1 to match, got %v", got)
+	}
+
+	got = index.RankProximity("東京タワー", 10)
+
+	if len(got) != 1 || got[0].Offsets[0].DocumentID != 3 {
+		t.Fatalf("expected document 3 to match, got %v", got)
+	}
+
+	if got[0].Offsets[1].Offset-got[0].Offsets[0].Offset != 3 {
+		t.Fatalf("expected the bigrams of the query to be adjacent, got %v", got)
+	}
+}
+
+func TestInvertedIndexNextPhrasePositionGaps(t *testing.T) {
+	index := NewInvertedIndex()
+
+	index.Index(1, "a walk past tower london bridge")
+	index.Index(2, "we visited the tower of london")
+
+	expected := []Position{{DocumentID: 2, Offset: 3}, {DocumentID: 2, Offset: 5}}
+
+	got := index.NextPhrase("tower of london", Position{DocumentID: BOF, Offset: BOF})
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	expected = []Position{{DocumentID: 1, Offset: 3}, {DocumentID: 1, Offset: 4}}
+
+	got = index.NextPhrase("tower london", Position{DocumentID: BOF, Offset: BOF})
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	got = index.NextPhrase("tower london", Position{DocumentID: 1, Offset: 4})
+
+	if got[0].DocumentID != EOF {
+		t.Fatalf("expected the gap to rule out document 2, got %v", got)
+	}
+}
+
+func TestInvertedIndexNextSloppyPhrase(t *testing.T) {
+	index := NewInvertedIndex()
+
+	index.Index(1, "a walk from the tower to london")
+
+	expected := []Position{{DocumentID: 1, Offset: 4}, {DocumentID: 1, Offset: 6}}
+
+	got := index.NextSloppyPhrase("tower london", 1, Position{DocumentID: BOF, Offset: BOF})
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestInvertedIndexSynonyms(t *testing.T) {
+	config := analyzer.DefaultConfig()
+	for j, filter := range config.Filters {
+		if filter.Type == "synonym" {
+			config.Filters[j].Params = json.RawMessage(`{"rules": ["k8s, kubernetes", "nyc => new york"]}`)
+		}
+	}
+
+	a, err := analyzer.New(config)
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	index := NewInvertedIndex()
+	index.SetAnalyzer(a)
+
+	index.Index(1, "deploying kubernetes clusters")
+	index.Index(2, "the k8s operator")
+	index.Index(3, "moving to new york next year")
+
+	got := index.RankProximity("k8s", 10)
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 matches, got %v", got)
+	}
+
+	expected := []Position{{DocumentID: 3, Offset: 2}, {DocumentID: 3, Offset: 5}}
+
+	phrase := index.NextPhrase("nyc next year", Position{DocumentID: BOF, Offset: BOF})
+
+	if !reflect.DeepEqual(expected, phrase) {
+		t.Fatalf("expected %v, got %v", expected, phrase)
+	}
+}
+
+func TestInvertedIndexRankProximityTopK(t *testing.T) {
+	index := NewInvertedIndex()
+
+	index.Index(1, "batman lives in a city called gotham")
+	index.Index(2, "batman gotham")
+
+	got := index.RankProximity("batman gotham", 1)
+
+	if len(got) != 1 || got[0].Offsets[0].DocumentID != 2 {
+		t.Fatalf("expected document 2 to rank first, got %v", got)
+	}
+}
+
+func TestInvertedIndexRankProximityIDF(t *testing.T) {
+	index := NewInvertedIndex()
+
+	index.Index(1, "gotham city")
+	index.Index(2, "gotham knights")
+	index.Index(3, "gotham villains")
+	index.Index(4, "batman")
+
+	common := index.RankProximity("gotham", 10)
+	rare := index.RankProximity("batman", 10)
+
+	if len(common) != 3 || len(rare) != 1 || rare[0].Score <= common[0].Score {
+		t.Fatalf("expected a rare term to outscore a common one, got %v and %v", rare, common)
+	}
+}
+
+func TestInvertedIndexDocumentCount(t *testing.T) {
+	index := NewInvertedIndex()
+
+	index.Index(1, "hello, my name is BATMAN!")
+	index.Index(2, "I have come to save Gotham!")
+
+	b, err := index.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloadedIndex := NewInvertedIndex()
+	if err := reloadedIndex.Decode(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if index.DocumentCount() != 2 || reloadedIndex.DocumentCount() != 2 {
+		t.Fatalf("expected %v, got %v and %v", 2, index.DocumentCount(), reloadedIndex.DocumentCount())
+	}
+
+	stats := NewCorpusStatistics(index, reloadedIndex)
+	if stats.DocumentCount() != 4 || stats.DocumentFrequency("gotham") != 2 {
+		t.Fatalf("expected %v and %v, got %v and %v", 4, 2, stats.DocumentCount(), stats.DocumentFrequency("gotham"))
+	}
+}
@@ -0,0 +1,96 @@
+package index
+
+// levenshteinAutomaton accepts every string within maxEdits edits of term.
+// Rather than compiling a DFA up front it simulates one lazily: a state is the
+// sparse row of the Wagner-Fischer matrix restricted to cells that can still
+// lead to an accepting state.
+//
+// Credit: https://julesjacobs.com/2015/06/17/disqus-levenshtein-simple-and-fast.html
+type levenshteinAutomaton struct {
+	term     []rune
+	maxEdits int
+}
+
+type levenshteinState struct {
+	indices []int
+	values  []int
+}
+
+func newLevenshteinAutomaton(term string, maxEdits int) *levenshteinAutomaton {
+	return &levenshteinAutomaton{term: []rune(term), maxEdits: maxEdits}
+}
+
+func (a *levenshteinAutomaton) start() levenshteinState {
+	n := a.maxEdits + 1
+	if n > len(a.term)+1 {
+		n = len(a.term) + 1
+	}
+
+	state := levenshteinState{indices: make([]int, n), values: make([]int, n)}
+	for i := 0; i < n; i++ {
+		state.indices[i] = i
+		state.values[i] = i
+	}
+
+	return state
+}
+
+func (a *levenshteinAutomaton) step(state levenshteinState, c rune) levenshteinState {
+	next := levenshteinState{}
+
+	if len(state.indices) > 0 && state.indices[0] == 0 && state.values[0] < a.maxEdits {
+		next.indices = append(next.indices, 0)
+		next.values = append(next.values, state.values[0]+1)
+	}
+
+	for j, i := range state.indices {
+		if i == len(a.term) {
+			break
+		}
+
+		cost := 1
+		if a.term[i] == c {
+			cost = 0
+		}
+
+		//substitution or match
+		val := state.values[j] + cost
+
+		//insertion
+		if len(next.indices) > 0 && next.indices[len(next.indices)-1] == i {
+			val = min(val, next.values[len(next.values)-1]+1)
+		}
+
+		//deletion
+		if j+1 < len(state.indices) && state.indices[j+1] == i+1 {
+			val = min(val, state.values[j+1]+1)
+		}
+
+		if val <= a.maxEdits {
+			next.indices = append(next.indices, i+1)
+			next.values = append(next.values, val)
+		}
+	}
+
+	return next
+}
+
+func (a *levenshteinAutomaton) isMatch(state levenshteinState) bool {
+	return len(state.indices) > 0 && state.indices[len(state.indices)-1] == len(a.term)
+}
+
+func (a *levenshteinAutomaton) canMatch(state levenshteinState) bool {
+	return len(state.indices) > 0
+}
+
+// distance is the edit distance of an accepted string.
+func (a *levenshteinAutomaton) distance(state levenshteinState) int {
+	return state.values[len(state.values)-1]
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,82 @@
+package index
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultMMRLambda weighs relevance and diversity equally.
+const DefaultMMRLambda = 0.5
+
+// MMR diversifies results by maximal marginal relevance: each pick maximizes
+// Lambda*relevance - (1-Lambda)*similarity to the hits already picked, so
+// near-duplicates of a better hit sink. Lambda 1 keeps the fused order and
+// Lambda 0 only seeks diversity.
+type MMR struct {
+	Lambda float64
+}
+
+func (m MMR) Validate() error {
+	if m.Lambda < 0 || m.Lambda > 1 {
+		return fmt.Errorf("index: mmr lambda must be between 0 and 1, got %v", m.Lambda)
+	}
+	return nil
+}
+
+// Diversify picks k matches from the fused matches by maximal marginal
+// relevance. Relevance is the fused score rescaled to [0, 1], similarity the
+// cosine similarity of the document vectors. Matches keep their fused score,
+// so the result is no longer sorted by it. Documents without a vector are
+// similar to nothing.
+func Diversify(matches []Match, vectors map[int][]float64, mmr MMR, k int) []Match {
+	k = int(math.Min(float64(k), float64(len(matches))))
+	relevance := normalize(matches, MinMaxNormalization, 1)
+
+	//maxSimilarity[i] is the highest similarity of match i to a picked match
+	maxSimilarity := make([]float64, len(matches))
+	picked := make([]bool, len(matches))
+	selected := []Match{}
+
+	for len(selected) < k {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range matches {
+			if picked[i] {
+				continue
+			}
+
+			score := mmr.Lambda*relevance[i] - (1-mmr.Lambda)*maxSimilarity[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		picked[best] = true
+		selected = append(selected, matches[best])
+
+		v := vectors[int(matches[best].Offsets[0].DocumentID)]
+		for i := range matches {
+			if picked[i] {
+				continue
+			}
+			if s := similarity(v, vectors[int(matches[i].Offsets[0].DocumentID)]); s > maxSimilarity[i] {
+				maxSimilarity[i] = s
+			}
+		}
+	}
+
+	return selected
+}
+
+// similarity is the cosine similarity of a and b, 0 when either is missing,
+// empty or zero.
+func similarity(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	s := 1 - distance(a, b)
+	if math.IsNaN(s) {
+		return 0
+	}
+	return s
+}
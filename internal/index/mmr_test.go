@@ -0,0 +1,59 @@
+package index
+
+import "testing"
+
+func TestDiversify(t *testing.T) {
+	//document 2 is a near-duplicate of document 1
+	matches := matchesOf([]float64{1, 2, 3}, []float64{0.9, 0.85, 0.5})
+	vectors := map[int][]float64{
+		1: {1, 0, 0},
+		2: {0.99, 0.01, 0},
+		3: {0, 1, 0},
+	}
+
+	got := Diversify(matches, vectors, MMR{Lambda: 0.5}, 3)
+	if ids := documentIDs(got); !equalIDs(ids, []float64{1, 3, 2}) {
+		t.Fatalf("expected %v, got %v", []float64{1, 3, 2}, ids)
+	}
+
+	//relevance alone keeps the fused order
+	got = Diversify(matches, vectors, MMR{Lambda: 1}, 2)
+	if ids := documentIDs(got); !equalIDs(ids, []float64{1, 2}) {
+		t.Fatalf("expected %v, got %v", []float64{1, 2}, ids)
+	}
+}
+
+func TestHNSWVectors(t *testing.T) {
+	hnsw := NewHNSW(3, 0.62, 2, 16)
+	hnsw.Create([]VectorNode{{ID: 1, Vector: []float64{1, 0}}, {ID: 2, Vector: []float64{0, 1}}})
+
+	vectors := hnsw.Vectors(map[int]bool{2: true, 3: true})
+	if len(vectors) != 1 || vectors[2][1] != 1 {
+		t.Fatalf("expected %v, got %v", map[int][]float64{2: {0, 1}}, vectors)
+	}
+	//chunks of a document are averaged, also once the index is reloaded
+	hnsw.Create([]VectorNode{{ID: 2, Vector: []float64{0, 3}, Start: 5, End: 9}})
+
+	b, err := hnsw.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &HNSW{}
+	if err := decoded.Decode(b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, h := range []*HNSW{hnsw, decoded} {
+		vectors = h.Vectors(map[int]bool{1: true, 2: true})
+		if len(vectors) != 2 || vectors[1][0] != 1 || vectors[2][1] != 2 {
+			t.Fatalf("expected %v, got %v", map[int][]float64{1: {1, 0}, 2: {0, 2}}, vectors)
+		}
+	}
+}
+
+func TestMMRValidate(t *testing.T) {
+	if err := (Query{Text: "q", MMR: &MMR{Lambda: 1.5}}).Validate(); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
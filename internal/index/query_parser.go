@@ -1 +1,207 @@
 package index
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/farouqzaib/fast-search/internal/analyzer"
+)
+
+const (
+	// maxFuzziness is the largest edit distance a fuzzy term may ask for.
+	maxFuzziness = 2
+	// maxQueryVariants caps the number of variants a query expands to.
+	maxQueryVariants = 16
+)
+
+type termKind int
+
+const (
+	exactTerm termKind = iota
+	wildcardTerm
+	fuzzyTerm
+)
+
+type queryTerm struct {
+	text     string
+	kind     termKind
+	distance int
+}
+
+// weightedTerm is a dictionary term standing in for a query term. Exact and
+// wildcard matches carry a weight of 1 while fuzzy matches are penalised by
+// their edit distance.
+type weightedTerm struct {
+	term   string
+	weight float64
+}
+
+// parseQuery turns a raw query into its variants, one for every combination
+// of synonyms the query expands to. Runs of plain words go through the full
+// analyzer, words containing '*' or '?' are only lowercased so their
+// patterns can be expanded against the term dictionary and words suffixed
+// with '~' (optionally followed by an edit distance, e.g. term~1) are
+// matched fuzzily.
+func parseQuery(a *analyzer.Analyzer, query string) [][]queryTerm {
+	variants := [][]queryTerm{{}}
+	plain := []string{}
+
+	//plain words are analyzed together so multi-word synonyms are found
+	flush := func() {
+		if len(plain) == 0 {
+			return
+		}
+
+		alternatives := [][]queryTerm{}
+		for _, tokens := range a.QueryVariants(strings.Join(plain, " ")) {
+			terms := []queryTerm{}
+			for _, token := range tokens {
+				terms = append(terms, queryTerm{text: token.Term, kind: exactTerm})
+			}
+			alternatives = append(alternatives, terms)
+		}
+
+		variants = combineVariants(variants, alternatives)
+		plain = plain[:0]
+	}
+
+	for _, word := range strings.Fields(query) {
+		if analyzer.IsWildcard(word) {
+			flush()
+			variants = combineVariants(variants, [][]queryTerm{parseWildcard(a, word)})
+			continue
+		}
+
+		if text, distance, ok := parseFuzzy(word); ok {
+			flush()
+			terms := []queryTerm{}
+			for _, token := range a.Analyze(text) {
+				terms = append(terms, queryTerm{text: token, kind: fuzzyTerm, distance: distance})
+			}
+			variants = combineVariants(variants, [][]queryTerm{terms})
+			continue
+		}
+
+		plain = append(plain, word)
+	}
+
+	flush()
+
+	return variants
+}
+
+// combineVariants appends every alternative to every variant, keeping at
+// most maxQueryVariants of them.
+func combineVariants(variants [][]queryTerm, alternatives [][]queryTerm) [][]queryTerm {
+	combined := [][]queryTerm{}
+
+	for _, variant := range variants {
+		for _, alternative := range alternatives {
+			if len(combined) == maxQueryVariants {
+				return combined
+			}
+
+			terms := append([]queryTerm{}, variant...)
+			combined = append(combined, append(terms, alternative...))
+		}
+	}
+
+	return combined
+}
+
+func parseWildcard(a *analyzer.Analyzer, word string) []queryTerm {
+	terms := []queryTerm{}
+
+	for _, token := range a.AnalyzeWildcard(word) {
+		if analyzer.IsWildcard(token) {
+			terms = append(terms, queryTerm{text: token, kind: wildcardTerm})
+			continue
+		}
+
+		for _, t := range a.Analyze(token) {
+			terms = append(terms, queryTerm{text: t, kind: exactTerm})
+		}
+	}
+
+	return terms
+}
+
+// parseFuzzy splits a word of the form term~N into its text and edit
+// distance. A bare term~ picks the distance from the length of the term.
+func parseFuzzy(word string) (string, int, bool) {
+	idx := strings.LastIndex(word, "~")
+	if idx <= 0 {
+		return word, 0, false
+	}
+
+	text, suffix := word[:idx], word[idx+1:]
+	if suffix == "" {
+		return text, autoFuzziness(text), true
+	}
+
+	distance, err := strconv.Atoi(suffix)
+	if err != nil || distance < 0 {
+		return word, 0, false
+	}
+
+	if distance > maxFuzziness {
+		distance = maxFuzziness
+	}
+
+	return text, distance, true
+}
+
+// autoFuzziness allows more edits as terms get longer: short terms have too
+// many neighbours for a typo to be recovered reliably.
+func autoFuzziness(term string) int {
+	switch n := utf8.RuneCountInString(term); {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	default:
+		return maxFuzziness
+	}
+}
+
+func fuzzyWeight(distance int) float64 {
+	return 1. / (float64(distance) + 1.)
+}
+
+// expandQuery resolves every query term to the dictionary terms whose
+// postings should be unioned when looking for covers. Exact terms missing
+// from every document of stats fall back to a fuzzy match, so a term found
+// in another partition is not replaced by its neighbours in this one.
+func (i *InvertedIndex) expandQuery(terms []queryTerm, stats Statistics) [][]weightedTerm {
+	expanded := make([][]weightedTerm, len(terms))
+
+	for j, term := range terms {
+		switch term.kind {
+		case wildcardTerm:
+			for _, t := range i.Dictionary.Expand(term.text, i.MaxExpansions) {
+				expanded[j] = append(expanded[j], weightedTerm{term: t, weight: 1})
+			}
+		case fuzzyTerm:
+			expanded[j] = i.expandFuzzy(term.text, term.distance)
+		default:
+			if stats.DocumentFrequency(term.text) == 0 {
+				expanded[j] = i.expandFuzzy(term.text, autoFuzziness(term.text))
+				continue
+			}
+			expanded[j] = []weightedTerm{{term: term.text, weight: 1}}
+		}
+	}
+
+	return expanded
+}
+
+func (i *InvertedIndex) expandFuzzy(text string, distance int) []weightedTerm {
+	terms := []weightedTerm{}
+
+	for _, t := range i.Dictionary.Fuzzy(text, distance, i.MaxExpansions) {
+		terms = append(terms, weightedTerm{term: t.Term, weight: fuzzyWeight(t.Distance)})
+	}
+
+	return terms
+}
@@ -1 +1,65 @@
 package index
+
+import (
+	"math"
+	"sync"
+)
+
+// Statistics are the corpus statistics term weights are computed from. An
+// index uses its own by default; a search over several memtables and segments
+// shares the statistics of all of them so scores stay comparable.
+type Statistics interface {
+	DocumentCount() int
+	DocumentFrequency(term string) int
+}
+
+// idf is the BM25 inverse document frequency of a term found in df of n
+// documents. It is always positive, so very common terms still count a little.
+func idf(n, df int) float64 {
+	return math.Log(1 + (float64(n)-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+// CorpusStatistics sums the statistics of several inverted indexes.
+// Frequencies are memoized, so it should only live as long as one search.
+type CorpusStatistics struct {
+	mu          sync.Mutex
+	indexes     []*InvertedIndex
+	count       int
+	frequencies map[string]int
+}
+
+func NewCorpusStatistics(indexes ...*InvertedIndex) *CorpusStatistics {
+	count := 0
+	for _, i := range indexes {
+		count += i.DocumentCount()
+	}
+
+	return &CorpusStatistics{
+		indexes:     indexes,
+		count:       count,
+		frequencies: map[string]int{},
+	}
+}
+
+// DocumentCount returns the number of documents across all indexes. A
+// document indexed again in a later memtable is counted once per index.
+func (c *CorpusStatistics) DocumentCount() int {
+	return c.count
+}
+
+func (c *CorpusStatistics) DocumentFrequency(term string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if df, ok := c.frequencies[term]; ok {
+		return df
+	}
+
+	df := 0
+	for _, i := range c.indexes {
+		df += i.DocumentFrequency(term)
+	}
+	c.frequencies[term] = df
+
+	return df
+}
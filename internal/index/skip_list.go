@@ -18,6 +18,10 @@ var BOF = math.Inf(-1)
 type Position struct {
 	DocumentID float64
 	Offset     float64
+	// Start and End are the byte offsets of the token in the original
+	// document. They are only set when the index stores offsets.
+	Start int
+	End   int
 }
 
 func (d *Position) GetDocumentID() int {
@@ -153,12 +157,12 @@ func (s *SkipList) Insert(key Position) {
 	found, journey := s.Search(key)
 
 	if found != nil {
-		found.Key = Position{DocumentID: key.DocumentID, Offset: key.Offset}
+		found.Key = key
 		return
 	}
 
 	height := s.randomHeight()
-	node := &Node{Key: Position{DocumentID: key.DocumentID, Offset: key.Offset}}
+	node := &Node{Key: key}
 
 	for level := 0; level < height; level++ {
 		prev := journey[level]
@@ -0,0 +1,190 @@
+package index
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"sort"
+	"sync"
+)
+
+// SparseVector maps the terms, or token ids, of a learned sparse model such
+// as SPLADE to their weights. Only positive weights are indexed and searched.
+type SparseVector map[string]float64
+
+type SparsePosting struct {
+	DocumentID int
+	Weight     float64
+}
+
+// SparseIndex is an inverted index of sparse vectors. Postings are sorted by
+// document and every term records its highest weight, the upper bound WAND
+// needs to skip documents that cannot make the top k.
+type SparseIndex struct {
+	mu         sync.Mutex
+	Postings   map[string][]SparsePosting
+	MaxWeights map[string]float64
+}
+
+func NewSparseIndex() *SparseIndex {
+	return &SparseIndex{
+		Postings:   map[string][]SparsePosting{},
+		MaxWeights: map[string]float64{},
+	}
+}
+
+// Index adds the sparse vector of a document, replacing the weights of a
+// document indexed again.
+func (s *SparseIndex) Index(docID int, vector SparseVector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for term, weight := range vector {
+		if weight <= 0 {
+			continue
+		}
+
+		postings := s.Postings[term]
+		i := sort.Search(len(postings), func(i int) bool {
+			return postings[i].DocumentID >= docID
+		})
+
+		if i < len(postings) && postings[i].DocumentID == docID {
+			postings[i].Weight = weight
+		} else {
+			postings = append(postings, SparsePosting{})
+			copy(postings[i+1:], postings[i:])
+			postings[i] = SparsePosting{DocumentID: docID, Weight: weight}
+		}
+		s.Postings[term] = postings
+
+		//a replaced weight leaves a bound that is too high, which is safe
+		if weight > s.MaxWeights[term] {
+			s.MaxWeights[term] = weight
+		}
+	}
+}
+
+// sparseCursor walks the postings of one query term.
+type sparseCursor struct {
+	postings []SparsePosting
+	position int
+	weight   float64
+	bound    float64
+}
+
+func (c *sparseCursor) document() int {
+	if c.position >= len(c.postings) {
+		return math.MaxInt
+	}
+	return c.postings[c.position].DocumentID
+}
+
+// seek moves the cursor to the first posting of a document at or after docID.
+func (c *sparseCursor) seek(docID int) {
+	rest := c.postings[c.position:]
+	c.position += sort.Search(len(rest), func(i int) bool {
+		return rest[i].DocumentID >= docID
+	})
+}
+
+// Search returns the k documents with the highest dot product with query,
+// best first. It uses WAND: cursors are kept sorted by document and the pivot
+// is the first document whose cursors' upper bounds could beat the k-th best
+// score, so every document before it is skipped without being scored.
+func (s *SparseIndex) Search(query SparseVector, k int) []Match {
+	cursors := []*sparseCursor{}
+	for term, weight := range query {
+		postings, ok := s.Postings[term]
+		if !ok || weight <= 0 {
+			continue
+		}
+		cursors = append(cursors, &sparseCursor{postings: postings, weight: weight, bound: weight * s.MaxWeights[term]})
+	}
+
+	top := []Match{}
+	if k <= 0 {
+		return top
+	}
+
+	//scores are positive, so any document beats an empty slot
+	threshold := func() float64 {
+		if len(top) < k {
+			return 0
+		}
+		return top[k-1].Score
+	}
+
+	for {
+		sort.Slice(cursors, func(i, j int) bool {
+			return cursors[i].document() < cursors[j].document()
+		})
+
+		pivot, bound := -1, 0.
+		for i, c := range cursors {
+			if c.document() == math.MaxInt {
+				break
+			}
+			bound += c.bound
+			if bound > threshold() {
+				pivot = i
+				break
+			}
+		}
+
+		if pivot < 0 {
+			break
+		}
+
+		pivotDocument := cursors[pivot].document()
+
+		//documents before the pivot cannot beat the threshold
+		if cursors[0].document() != pivotDocument {
+			for _, c := range cursors[:pivot] {
+				c.seek(pivotDocument)
+			}
+			continue
+		}
+
+		score := 0.
+		for _, c := range cursors {
+			if c.document() != pivotDocument {
+				break
+			}
+			score += c.weight * c.postings[c.position].Weight
+			c.position++
+		}
+
+		if score > threshold() {
+			i := sort.Search(len(top), func(i int) bool {
+				return top[i].Score < score
+			})
+			top = append(top, Match{})
+			copy(top[i+1:], top[i:])
+			top[i] = Match{Offsets: []Position{{DocumentID: float64(pivotDocument)}}, Score: score}
+			if len(top) > k {
+				top = top[:k]
+			}
+		}
+	}
+
+	return top
+}
+
+func (s *SparseIndex) Encode() ([]byte, error) {
+	var b bytes.Buffer
+	enc := gob.NewEncoder(&b)
+
+	err := enc.Encode(s)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (s *SparseIndex) Decode(b []byte) error {
+	buf := bytes.NewBuffer(b)
+	dec := gob.NewDecoder(buf)
+
+	return dec.Decode(s)
+}
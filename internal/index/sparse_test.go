@@ -0,0 +1,109 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSparseIndexSearch(t *testing.T) {
+	s := NewSparseIndex()
+	s.Index(1, SparseVector{"raft": 1.5, "consensus": 0.5})
+	s.Index(2, SparseVector{"paxos": 2, "consensus": 1})
+	s.Index(3, SparseVector{"raft": 0.2, "ignored": -1})
+
+	matches := s.Search(SparseVector{"raft": 1, "consensus": 1}, 10)
+
+	expected := []float64{1, 2, 3}
+	if got := documentIDs(matches); !equalIDs(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	if matches[0].Score != 2 {
+		t.Fatalf("expected %v, got %v", 2, matches[0].Score)
+	}
+
+	if _, ok := s.Postings["ignored"]; ok {
+		t.Fatalf("expected a negative weight not to be indexed")
+	}
+
+	//indexing a document again replaces its weights
+	s.Index(3, SparseVector{"raft": 3})
+	matches = s.Search(SparseVector{"raft": 1}, 1)
+	if len(matches) != 1 || matches[0].Offsets[0].DocumentID != 3 || matches[0].Score != 3 {
+		t.Fatalf("expected document %v scoring %v, got %v", 3, 3, matches)
+	}
+}
+
+func TestSparseIndexWAND(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	terms := []string{}
+	for i := 0; i < 30; i++ {
+		terms = append(terms, fmt.Sprintf("t%d", i))
+	}
+
+	s := NewSparseIndex()
+	vectors := map[int]SparseVector{}
+	for doc := 0; doc < 500; doc++ {
+		v := SparseVector{}
+		for i := 0; i < 5; i++ {
+			v[terms[r.Intn(len(terms))]] = r.Float64()
+		}
+		vectors[doc] = v
+		s.Index(doc, v)
+	}
+
+	for trial := 0; trial < 20; trial++ {
+		query := SparseVector{}
+		for i := 0; i < 4; i++ {
+			query[terms[r.Intn(len(terms))]] = r.Float64()
+		}
+
+		//brute force dot products
+		expected := []float64{}
+		for doc := 0; doc < 500; doc++ {
+			score := 0.
+			for term, weight := range query {
+				score += weight * vectors[doc][term]
+			}
+			if score > 0 {
+				expected = append(expected, score)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.Float64Slice(expected)))
+		expected = expected[:10]
+
+		matches := s.Search(query, 10)
+		if len(matches) != 10 {
+			t.Fatalf("expected %v, got %v", 10, len(matches))
+		}
+
+		for i, m := range matches {
+			if math.Abs(m.Score-expected[i]) > 1e-9 {
+				t.Fatalf("expected %v, got %v", expected, scores(matches))
+			}
+		}
+	}
+}
+
+func TestSparseIndexEncode(t *testing.T) {
+	s := NewSparseIndex()
+	s.Index(7, SparseVector{"gotham": 0.8})
+
+	b, err := s.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := NewSparseIndex()
+	if err := decoded.Decode(b); err != nil {
+		t.Fatal(err)
+	}
+
+	matches := decoded.Search(SparseVector{"gotham": 1}, 10)
+	if len(matches) != 1 || matches[0].Offsets[0].DocumentID != 7 {
+		t.Fatalf("expected %v, got %v", 7, matches)
+	}
+}
@@ -0,0 +1,143 @@
+package index
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/farouqzaib/fast-search/internal/analyzer"
+)
+
+const (
+	// maxCandidates is the number of corrections kept for each missing token.
+	maxCandidates = 5
+)
+
+// Suggester proposes corrected queries when query tokens are missing from
+// the postings of every index. Candidates are the surface forms of indexed
+// words, so users are offered words rather than stems, and are ranked by
+// edit distance, then by document frequency across indexes. Words are
+// analyzed in the language of the whole query, or of most documents when the
+// query is too short for its language to be detected.
+type Suggester struct {
+	analyzer *analyzer.Analyzer
+	indexes  []*InvertedIndex
+}
+
+type suggestion struct {
+	term      string
+	distance  int
+	frequency int
+}
+
+func NewSuggester(a *analyzer.Analyzer, indexes []*InvertedIndex) *Suggester {
+	return &Suggester{analyzer: a, indexes: indexes}
+}
+
+// Suggest returns up to n corrected queries, or none if every token of the
+// query is already indexed.
+func (s *Suggester) Suggest(query string, n int) []string {
+	words := strings.Fields(query)
+	corrections := make([][]suggestion, len(words))
+
+	a := s.analyzer
+	if lang := a.QueryLanguage(query, dominantLanguage(s.indexes...)); lang != "" {
+		a = a.ForLanguage(lang)
+	}
+
+	missing := false
+	for j, word := range words {
+		//operator terms are spelled on purpose
+		if analyzer.IsWildcard(word) || strings.Contains(word, "~") {
+			continue
+		}
+
+		tokens, surface := a.Analyze(word), a.Words(word)
+		if len(tokens) != 1 || len(surface) != 1 || s.frequency(tokens[0]) > 0 {
+			continue
+		}
+
+		corrections[j] = s.candidates(surface[0])
+		if len(corrections[j]) > 0 {
+			missing = true
+		}
+	}
+
+	if !missing {
+		return []string{}
+	}
+
+	suggestions := []string{}
+	seen := map[string]bool{}
+	for rank := 0; rank < n && rank < maxCandidates; rank++ {
+		corrected := make([]string, len(words))
+		for j, word := range words {
+			corrected[j] = word
+			if len(corrections[j]) > 0 {
+				corrected[j] = corrections[j][min(rank, len(corrections[j])-1)].term
+			}
+		}
+
+		q := strings.Join(corrected, " ")
+		if !seen[q] {
+			seen[q] = true
+			suggestions = append(suggestions, q)
+		}
+	}
+
+	return suggestions
+}
+
+// candidates returns the indexed words closest to word, both in their
+// surface form.
+func (s *Suggester) candidates(word string) []suggestion {
+	distance := autoFuzziness(word)
+	if distance == 0 {
+		return []suggestion{}
+	}
+
+	found := map[string]int{}
+	for _, i := range s.indexes {
+		for _, t := range i.Completion.Fuzzy(word, distance, DefaultMaxExpansions) {
+			found[t.Term] = t.Distance
+		}
+	}
+
+	candidates := []suggestion{}
+	for word, d := range found {
+		candidates = append(candidates, suggestion{term: word, distance: d, frequency: s.wordFrequency(word)})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		if candidates[i].frequency != candidates[j].frequency {
+			return candidates[i].frequency > candidates[j].frequency
+		}
+		return candidates[i].term < candidates[j].term
+	})
+
+	if len(candidates) > maxCandidates {
+		candidates = candidates[:maxCandidates]
+	}
+
+	return candidates
+}
+
+// wordFrequency returns the number of documents across indexes containing
+// the surface form word.
+func (s *Suggester) wordFrequency(word string) int {
+	frequency := 0
+	for _, i := range s.indexes {
+		frequency += i.Completion.Weights[word]
+	}
+	return frequency
+}
+
+func (s *Suggester) frequency(term string) int {
+	frequency := 0
+	for _, i := range s.indexes {
+		frequency += i.DocumentFrequency(term)
+	}
+	return frequency
+}
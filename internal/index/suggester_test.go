@@ -0,0 +1,52 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/farouqzaib/fast-search/internal/analyzer"
+)
+
+func TestSuggesterSuggest(t *testing.T) {
+	memtable := NewInvertedIndex()
+	memtable.Index(1, "I have come to save Gotham!")
+	memtable.Index(2, "Gotham needs a hero")
+
+	segment := NewInvertedIndex()
+	segment.Index(3, "the gothic cathedral")
+	segment.Index(4, "Where in Gotham is the Joker?")
+
+	suggester := NewSuggester(analyzer.Default(), []*InvertedIndex{memtable, segment})
+
+	expected := []string{"save gotham", "save gothic"}
+
+	got := suggester.Suggest("save gothem", 3)
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestSuggesterSuggestKnownTokens(t *testing.T) {
+	index := NewInvertedIndex()
+	index.Index(1, "I have come to save Gotham!")
+
+	got := NewSuggester(analyzer.Default(), []*InvertedIndex{index}).Suggest("save gotham", 3)
+
+	if len(got) != 0 {
+		t.Fatalf("expected no suggestions, got %v", got)
+	}
+}
+
+func TestSuggesterSuggestSurfaceForms(t *testing.T) {
+	index := NewInvertedIndex()
+	index.Index(1, "the gothic cathedral")
+
+	expected := []string{"gothic cathedral"}
+
+	got := NewSuggester(analyzer.Default(), []*InvertedIndex{index}).Suggest("gothic cathedrel", 3)
+
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
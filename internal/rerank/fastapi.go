@@ -0,0 +1,66 @@
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type RerankRequest struct {
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+}
+
+type RerankResponse struct {
+	Status string    `json:"status"`
+	Data   []float64 `json:"data"`
+}
+
+// FastAPI scores documents with the cross-encoder served by third_party.
+type FastAPI struct {
+	url    string
+	client *http.Client
+}
+
+func NewFastAPI(url string) *FastAPI {
+	return &FastAPI{url: url, client: &http.Client{}}
+}
+
+func (f *FastAPI) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	body, err := json.Marshal(RerankRequest{Query: query, Documents: documents})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("rerank: service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	var scores RerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&scores); err != nil {
+		return nil, err
+	}
+
+	if scores.Status != "success" {
+		return nil, fmt.Errorf("rerank: service returned status %q", scores.Status)
+	}
+
+	return scores.Data, nil
+}
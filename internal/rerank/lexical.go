@@ -0,0 +1,46 @@
+package rerank
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// Lexical is a deterministic reranker scoring documents by the share of
+// distinct query words they contain. It needs no service, which makes it
+// useful for tests and offline use, but knows nothing of meaning.
+type Lexical struct{}
+
+func NewLexical() *Lexical {
+	return &Lexical{}
+}
+
+func (l *Lexical) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	terms := words(query)
+	scores := make([]float64, len(documents))
+	if len(terms) == 0 {
+		return scores, nil
+	}
+
+	for i, document := range documents {
+		found := words(document)
+		for term := range terms {
+			if found[term] {
+				scores[i]++
+			}
+		}
+		scores[i] /= float64(len(terms))
+	}
+
+	return scores, nil
+}
+
+func words(text string) map[string]bool {
+	r := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	}) {
+		r[w] = true
+	}
+	return r
+}
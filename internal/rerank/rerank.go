@@ -0,0 +1,110 @@
+package rerank
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/farouqzaib/fast-search/internal/index"
+)
+
+const (
+	FastAPIProvider = "fastapi"
+	LexicalProvider = "lexical"
+
+	// DefaultTopN is the number of hits reranked when a request does not say.
+	DefaultTopN = 50
+	// DefaultTimeout is the deadline of a rerank call. Reranking is optional,
+	// so a slow reranker should not hold a search back for long.
+	DefaultTimeout = 2 * time.Second
+)
+
+// Reranker scores how relevant each document is to query, typically with a
+// cross-encoder reading both together. Higher scores are more relevant.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, documents []string) ([]float64, error)
+}
+
+// Config selects and configures a reranker.
+type Config struct {
+	// Provider is one of fastapi or lexical.
+	Provider string
+	// URL is the /rerank endpoint of the fastapi service.
+	URL string
+}
+
+// New returns the reranker described by config.
+func New(config Config) (Reranker, error) {
+	switch config.Provider {
+	case "", FastAPIProvider:
+		if config.URL == "" {
+			return nil, fmt.Errorf("rerank: no url for the %s provider", FastAPIProvider)
+		}
+		return NewFastAPI(config.URL), nil
+	case LexicalProvider:
+		return NewLexical(), nil
+	default:
+		return nil, fmt.Errorf("rerank: unknown provider %q", config.Provider)
+	}
+}
+
+// Matches reorders the first topN matches by the scores r gives to their
+// documents, which become their scores. The remaining matches follow in their
+// original order. Matches are left untouched when r fails.
+func Matches(ctx context.Context, r Reranker, query string, matches []index.Match, documents []string, topN int) ([]index.Match, error) {
+	if len(matches) != len(documents) {
+		return nil, fmt.Errorf("rerank: %d documents for %d matches", len(documents), len(matches))
+	}
+
+	if topN > len(matches) {
+		topN = len(matches)
+	}
+	if topN == 0 {
+		return matches, nil
+	}
+
+	scores, err := r.Rerank(ctx, query, documents[:topN])
+	if err != nil {
+		return matches, err
+	}
+
+	if len(scores) != topN {
+		return matches, fmt.Errorf("rerank: reranker returned %d scores for %d documents", len(scores), topN)
+	}
+
+	reranked := make([]index.Match, 0, len(matches))
+	for i, match := range matches[:topN] {
+		match.Score = scores[i]
+		reranked = append(reranked, match)
+	}
+
+	//ties keep the order of the first stage
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return reranked[i].Score > reranked[j].Score
+	})
+
+	return append(reranked, matches[topN:]...), nil
+}
+
+// Timeout gives every call to a reranker a deadline.
+type Timeout struct {
+	reranker Reranker
+	timeout  time.Duration
+}
+
+// NewTimeout wraps reranker so its calls give up after timeout,
+// DefaultTimeout when it is zero.
+func NewTimeout(reranker Reranker, timeout time.Duration) *Timeout {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Timeout{reranker: reranker, timeout: timeout}
+}
+
+func (t *Timeout) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	return t.reranker.Rerank(ctx, query, documents)
+}
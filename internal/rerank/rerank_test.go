@@ -0,0 +1,88 @@
+package rerank
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/farouqzaib/fast-search/internal/index"
+)
+
+func matchesOf(docs ...float64) []index.Match {
+	r := []index.Match{}
+	for i, doc := range docs {
+		r = append(r, index.Match{Offsets: []index.Position{{DocumentID: doc}}, Score: float64(len(docs) - i)})
+	}
+	return r
+}
+
+func documentIDs(matches []index.Match) []float64 {
+	r := []float64{}
+	for _, m := range matches {
+		r = append(r, m.Offsets[0].DocumentID)
+	}
+	return r
+}
+
+func TestMatches(t *testing.T) {
+	matches := matchesOf(1, 2, 3, 4)
+	documents := []string{"the city", "batman saves gotham", "gotham city", "batman"}
+
+	got, err := Matches(context.Background(), NewLexical(), "batman gotham", matches, documents, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//document 4 is past topN, so it stays last whatever its text
+	expected := []float64{2, 3, 1, 4}
+	ids := documentIDs(got)
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, ids)
+		}
+	}
+
+	if got[0].Score != 1 || got[3].Score != 1 {
+		t.Fatalf("expected reranked and original scores, got %v", got)
+	}
+}
+
+func TestFastAPI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "success", "data": [0.1, 0.9]}`))
+	}))
+	defer srv.Close()
+
+	got, err := Matches(context.Background(), NewFastAPI(srv.URL), "q", matchesOf(1, 2), []string{"a", "b"}, DefaultTopN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := documentIDs(got); ids[0] != 2 || ids[1] != 1 {
+		t.Fatalf("expected %v, got %v", []float64{2, 1}, ids)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	matches := matchesOf(1, 2)
+	got, err := Matches(context.Background(), NewTimeout(NewFastAPI(srv.URL), 20*time.Millisecond), "q", matches, []string{"a", "b"}, DefaultTopN)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	//the first stage order survives a failed rerank
+	if ids := documentIDs(got); ids[0] != 1 || ids[1] != 2 {
+		t.Fatalf("expected %v, got %v", []float64{1, 2}, ids)
+	}
+}
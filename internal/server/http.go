@@ -1,21 +1,33 @@
 package server
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
+	"strings"
+	"unicode"
 
+	"github.com/farouqzaib/fast-search/internal/index"
+	"github.com/farouqzaib/fast-search/internal/rerank"
 	"github.com/farouqzaib/fast-search/internal/storage"
 	"github.com/gorilla/mux"
 	"go.etcd.io/bbolt"
 )
 
-func NewHttpServer(index *storage.DistributedDB, metadataStorage *bbolt.DB, logger *slog.Logger, addr string) *http.Server {
-	srv := newHttpServer(index, metadataStorage, logger)
+func NewHttpServer(index *storage.DistributedDB, metadataStorage *bbolt.DB, reranker rerank.Reranker, logger *slog.Logger, addr string) *http.Server {
+	srv := newHttpServer(index, metadataStorage, reranker, logger)
 	r := mux.NewRouter()
 	r.HandleFunc("/search", srv.handleSearch).Methods("GET")
+	r.HandleFunc("/suggest", srv.handleSuggest).Methods("GET")
+	r.HandleFunc("/synonyms", srv.handleGetSynonyms).Methods("GET")
+	r.HandleFunc("/synonyms", srv.handleSetSynonyms).Methods("PUT")
+	r.HandleFunc("/stopwords", srv.handleGetStopwords).Methods("GET")
+	r.HandleFunc("/stopwords", srv.handleSetStopwords).Methods("PUT")
 	r.HandleFunc("/index", srv.handleIndex).Methods("POST")
 	r.HandleFunc("/join", srv.handleJoin).Methods("POST")
 	r.HandleFunc("/bulkIndex", srv.handleBulkIndex).Methods("POST")
@@ -30,18 +42,84 @@ type httpServer struct {
 	index           *storage.DistributedDB
 	logger          *slog.Logger
 	metadataStorage *bbolt.DB
+	// reranker reorders hits when a search asks for it, nil when reranking
+	// is not configured.
+	reranker rerank.Reranker
 }
 
-func newHttpServer(index *storage.DistributedDB, metadataStorage *bbolt.DB, logger *slog.Logger) *httpServer {
+func newHttpServer(index *storage.DistributedDB, metadataStorage *bbolt.DB, reranker rerank.Reranker, logger *slog.Logger) *httpServer {
 	return &httpServer{
 		index:           index,
 		logger:          logger,
 		metadataStorage: metadataStorage,
+		reranker:        reranker,
 	}
 }
 
 type SearchRequest struct {
 	Query string `json:"query"`
+	// Vector is a precomputed query vector, used instead of embedding Query.
+	Vector []float64 `json:"vector,omitempty"`
+	// Sparse holds precomputed sparse term weights of the query.
+	Sparse index.SparseVector `json:"sparse,omitempty"`
+	// Mode is keyword, semantic, sparse or hybrid, see index.Query.
+	Mode   string         `json:"mode,omitempty"`
+	Fusion *FusionRequest `json:"fusion,omitempty"`
+	Rerank *RerankRequest `json:"rerank,omitempty"`
+	MMR    *MMRRequest    `json:"mmr,omitempty"`
+}
+
+// MMRRequest diversifies hits by maximal marginal relevance, trading
+// relevance for diversity as Lambda goes from 1 to 0.
+// index.DefaultMMRLambda is used when Lambda is missing.
+type MMRRequest struct {
+	Lambda *float64 `json:"lambda"`
+}
+
+func (m *MMRRequest) mmr() *index.MMR {
+	if m == nil {
+		return nil
+	}
+
+	if m.Lambda == nil {
+		return &index.MMR{Lambda: index.DefaultMMRLambda}
+	}
+
+	return &index.MMR{Lambda: *m.Lambda}
+}
+
+// RerankRequest asks for the TopN best hits to be reordered by the reranker,
+// rerank.DefaultTopN when it is zero.
+type RerankRequest struct {
+	TopN int `json:"topN"`
+}
+
+// FusionRequest selects how full-text, semantic and sparse results are
+// combined: rrf (default), linear, fts, semantic or sparse.
+type FusionRequest struct {
+	Strategy string  `json:"strategy"`
+	K        float64 `json:"k"`
+	Weights  struct {
+		FTS      float64 `json:"fts"`
+		Semantic float64 `json:"semantic"`
+		Sparse   float64 `json:"sparse"`
+	} `json:"weights"`
+	Normalization string `json:"normalization"`
+}
+
+func (f *FusionRequest) fusion() index.Fusion {
+	if f == nil {
+		return index.Fusion{}
+	}
+
+	return index.Fusion{
+		Strategy:       f.Strategy,
+		K:              f.K,
+		FTSWeight:      f.Weights.FTS,
+		SemanticWeight: f.Weights.Semantic,
+		SparseWeight:   f.Weights.Sparse,
+		Normalization:  f.Normalization,
+	}
 }
 
 type Hit struct {
@@ -49,10 +127,22 @@ type Hit struct {
 	Offset   []int   `json:"offset"`
 	Document string  `json:"document"`
 	Score    float64 `json:"score"`
+	// CharOffset is the byte range of the matched cover in the document.
+	CharOffset []int    `json:"charOffset,omitempty"`
+	Highlights []string `json:"highlights,omitempty"`
+	// Passage is the best matching chunk of a document indexed in chunks
+	// and PassageOffset its byte range in the document.
+	Passage       string `json:"passage,omitempty"`
+	PassageOffset []int  `json:"passageOffset,omitempty"`
 }
 
 type SearchResponse struct {
-	Hits []Hit `json:"hits"`
+	Hits        []Hit    `json:"hits"`
+	Suggestions []string `json:"suggestions,omitempty"`
+	// Fallback is "fts" when the query could not be embedded and only
+	// full-text search ran, Warning then holds the reason.
+	Fallback string `json:"fallback,omitempty"`
+	Warning  string `json:"warning,omitempty"`
 }
 
 func (s *httpServer) handleSearch(w http.ResponseWriter, r *http.Request) {
@@ -66,10 +156,42 @@ func (s *httpServer) handleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	q := index.Query{Text: req.Query, Vector: req.Vector, Sparse: req.Sparse, Mode: req.Mode, Fusion: req.Fusion.fusion(), MMR: req.MMR.mmr()}
+	if err := q.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	//the reranker may promote hits from beyond the first page
+	k := defaultSearchSize
+	if req.Rerank != nil {
+		if err := s.validateRerank(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Rerank.TopN == 0 {
+			req.Rerank.TopN = rerank.DefaultTopN
+		}
+		if req.Rerank.TopN > k {
+			k = req.Rerank.TopN
+		}
+	}
+
+	//reranking would undo the diversification, so the reranked hits are
+	//diversified instead of the fused ones
+	mmr := q.MMR
+	if req.Rerank != nil {
+		q.MMR = nil
+	}
+
 	s.logger.Info("query term", slog.String("query", req.Query))
 
-	matches, err := s.index.Search(req.Query, 10)
+	result, err := s.index.Search(r.Context(), q, k)
 
+	if errors.Is(err, storage.ErrDimensionMismatch) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		slog.Error("http: search", slog.String("error", err.Error()))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -77,6 +199,31 @@ func (s *httpServer) handleSearch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res := SearchResponse{}
+	if result.Fallback {
+		res.Fallback, res.Warning = "fts", result.Warning
+	}
+	//corrections are only worth their dictionary scan when the query found
+	//little
+	if req.Query != "" && len(result.Matches) < suggestBelowHits {
+		res.Suggestions = s.index.Suggest(req.Query, 3)
+	}
+
+	//a failed rerank keeps the fused order
+	if req.Rerank != nil {
+		result.Matches, err = s.rerank(r.Context(), req.Query, result.Matches, req.Rerank.TopN)
+		if err != nil {
+			s.logger.Warn("http: reranking, keeping fused results", slog.String("error", err.Error()))
+			res.Warning = strings.TrimPrefix(res.Warning+"; "+err.Error(), "; ")
+		}
+
+		if mmr != nil {
+			n := int(math.Min(float64(req.Rerank.TopN), float64(len(result.Matches))))
+			result.Matches = s.index.Diversify(result.Matches[:n], *mmr, defaultSearchSize)
+		}
+	}
+	if len(result.Matches) > defaultSearchSize {
+		result.Matches = result.Matches[:defaultSearchSize]
+	}
 
 	err = s.metadataStorage.View(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(storage.DocumentMetadataBucket))
@@ -84,7 +231,7 @@ func (s *httpServer) handleSearch(w http.ResponseWriter, r *http.Request) {
 			return errors.New("bucket does not exist")
 		}
 
-		for _, match := range matches {
+		for _, match := range result.Matches {
 			hit := Hit{
 				DocId:    int(match.Offsets[0].DocumentID),
 				Document: string(b.Get(itob(int(match.Offsets[0].DocumentID)))),
@@ -97,6 +244,21 @@ func (s *httpServer) handleSearch(w http.ResponseWriter, r *http.Request) {
 				hit.Offset = []int{int(match.Offsets[0].Offset), int(match.Offsets[1].Offset)}
 			}
 
+			if p := match.Passage; p != nil && p.End <= len(hit.Document) {
+				hit.Passage = hit.Document[p.Start:p.End]
+				hit.PassageOffset = []int{p.Start, p.End}
+			}
+
+			//vector-only queries and documents have nothing to highlight, the
+			//document is only re-analyzed when its offsets were not stored
+			if req.Query != "" && hit.Document != "" {
+				highlight := s.index.Highlight(hit.Document, req.Query, match.Offsets)
+				hit.Highlights = highlight.Fragments
+				if highlight.Start >= 0 {
+					hit.CharOffset = []int{highlight.Start, highlight.End}
+				}
+			}
+
 			res.Hits = append(res.Hits, hit)
 		}
 
@@ -117,12 +279,229 @@ func (s *httpServer) handleSearch(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// validateRerank rejects rerank requests the server cannot serve.
+func (s *httpServer) validateRerank(req SearchRequest) error {
+	if s.reranker == nil {
+		return errors.New("rerank: no reranker configured")
+	}
+
+	if req.Query == "" {
+		return errors.New("rerank: reranking needs a query text")
+	}
+
+	if req.Rerank.TopN < 0 {
+		return errors.New("rerank: topN must not be negative")
+	}
+
+	return nil
+}
+
+// rerank reorders the topN best matches by the relevance of their documents
+// to query.
+func (s *httpServer) rerank(ctx context.Context, query string, matches []index.Match, topN int) ([]index.Match, error) {
+	documents := make([]string, len(matches))
+
+	err := s.metadataStorage.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(storage.DocumentMetadataBucket))
+		if b == nil {
+			return errors.New("bucket does not exist")
+		}
+
+		for i, match := range matches {
+			documents[i] = string(b.Get(itob(int(match.Offsets[0].DocumentID))))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return matches, err
+	}
+
+	return rerank.Matches(ctx, s.reranker, query, matches, documents, topN)
+}
+
+// defaultSearchSize is the number of hits returned by a search.
+const defaultSearchSize = 10
+
+// suggestBelowHits is the number of hits below which a search suggests
+// corrected queries.
+const suggestBelowHits = 3
+
+const defaultSuggestSize = 5
+
+type SuggestRequest struct {
+	Query string `json:"query"`
+	Size  int    `json:"size"`
+}
+
+type Suggestion struct {
+	Text   string `json:"text"`
+	Weight int    `json:"weight"`
+}
+
+type SuggestResponse struct {
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+func (s *httpServer) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	var req SuggestRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Size <= 0 {
+		req.Size = defaultSuggestSize
+	}
+
+	res := SuggestResponse{Suggestions: []Suggestion{}}
+
+	//only the word being typed is completed, everything before it is kept as is
+	idx := strings.LastIndexFunc(req.Query, unicode.IsSpace)
+	typed, prefix := req.Query[:idx+1], strings.ToLower(req.Query[idx+1:])
+
+	if prefix != "" {
+		for _, completion := range s.index.Complete(prefix, req.Size) {
+			res.Suggestions = append(res.Suggestions, Suggestion{Text: typed + completion.Term, Weight: completion.Weight})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type Synonyms struct {
+	Rules []string `json:"rules"`
+}
+
+func (s *httpServer) handleGetSynonyms(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.index.Synonyms()
+	if err != nil {
+		slog.Error("http: synonyms", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(Synonyms{Rules: rules})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *httpServer) handleSetSynonyms(w http.ResponseWriter, r *http.Request) {
+	s.logger.Info("http: synonyms")
+	var req Synonyms
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		slog.Error("http: synonyms", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Rules == nil {
+		req.Rules = []string{}
+	}
+
+	err = s.index.SetSynonyms(req.Rules)
+	if errors.Is(err, storage.ErrNoSynonymFilter) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("http: synonyms", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(OkResponse{Status: "OK!"})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *httpServer) handleGetStopwords(w http.ResponseWriter, r *http.Request) {
+	stopwords, err := s.index.Stopwords()
+	if err != nil {
+		slog.Error("http: stopwords", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(stopwords)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type StopwordsResponse struct {
+	Status  string `json:"status"`
+	Warning string `json:"warning,omitempty"`
+}
+
+func (s *httpServer) handleSetStopwords(w http.ResponseWriter, r *http.Request) {
+	s.logger.Info("http: stopwords")
+	var req storage.Stopwords
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		slog.Error("http: stopwords", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	warning, err := s.index.SetStopwords(req)
+	if errors.Is(err, storage.ErrNoStopFilter) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("http: stopwords", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(StopwordsResponse{Status: "OK!", Warning: warning})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 type OkResponse struct {
 	Status string `json:"status"`
 }
 
 type Document struct {
 	Text string `json:"text"`
+	// Vector is a precomputed vector of the document, used instead of
+	// embedding Text. A document may have a vector and no text.
+	Vector []float64 `json:"vector,omitempty"`
+	// Sparse holds precomputed sparse term weights of the document, used
+	// instead of those of the embedding service.
+	Sparse index.SparseVector `json:"sparse,omitempty"`
+}
+
+// validate checks a document can be indexed before it is stored.
+func (s *httpServer) validate(document Document) error {
+	if document.Text == "" && document.Vector == nil {
+		return errors.New("a document needs a text or a vector")
+	}
+	return s.index.CheckVector(document.Vector)
 }
 
 func (s *httpServer) handleIndex(w http.ResponseWriter, r *http.Request) {
@@ -137,6 +516,12 @@ func (s *httpServer) handleIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = s.validate(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var docId int
 	err = s.metadataStorage.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(storage.DocumentMetadataBucket))
@@ -158,12 +543,14 @@ func (s *httpServer) handleIndex(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		slog.Error("http: indexing", slog.String("error", err.Error()))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	err = s.index.Index(docId, req.Text)
+	err = s.index.Index(docId, req.Text, req.Vector, req.Sparse)
 	if err != nil {
 		slog.Error("http: indexing", slog.String("error", err.Error()))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -235,6 +622,17 @@ func (s *httpServer) handleBulkIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	vectors := [][]float64{}
+	sparse := []index.SparseVector{}
+	for i, document := range req.Documents {
+		if err := s.validate(document); err != nil {
+			http.Error(w, fmt.Sprintf("document %d: %s", i, err.Error()), http.StatusBadRequest)
+			return
+		}
+		vectors = append(vectors, document.Vector)
+		sparse = append(sparse, document.Sparse)
+	}
+
 	docIds := []int{}
 	documents := []string{}
 	err = s.metadataStorage.Update(func(tx *bbolt.Tx) error {
@@ -262,13 +660,19 @@ func (s *httpServer) handleBulkIndex(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		slog.Error("http: bulk indexing", slog.String("error", err.Error()))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	//do bulk index using req
-	err = s.index.BulkIndex(docIds, documents)
+	err = s.index.BulkIndex(docIds, documents, vectors, sparse)
+	if errors.Is(err, storage.ErrDimensionMismatch) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		slog.Error("http: bulk indexing", slog.String("error", err.Error()))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1,14 +1,19 @@
 package storage
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"log/slog"
 	"math"
 	"os"
-	"sort"
+	"strings"
 
+	"github.com/farouqzaib/fast-search/internal/analyzer"
+	"github.com/farouqzaib/fast-search/internal/chunking"
+	"github.com/farouqzaib/fast-search/internal/embedding"
 	"github.com/farouqzaib/fast-search/internal/index"
 )
 
@@ -17,11 +22,57 @@ const (
 	memtableFlushThreshold   = bufLimit
 	VectorIndexSegmentPath   = "vectorindex"
 	InvertedIndexSegmentPath = "invertedindex"
+	CompletionSegmentPath    = "completion"
+	MetadataSegmentPath      = "metadata"
+	SparseIndexSegmentPath   = "sparseindex"
 	DocumentMetadataBucket   = "documentbucket"
 )
 
+var ErrDimensionMismatch = errors.New("vector dimensions do not match the collection")
+
+// IndexConfig holds the settings shared by every memtable and segment of an
+// index.
+type IndexConfig struct {
+	// MaxExpansions caps the number of dictionary terms a wildcard query term
+	// expands to in each memtable and segment.
+	MaxExpansions int
+	// Analyzer tokenizes documents and queries. Open gives the index its own
+	// analyzer with the default config when nil, since synonyms and
+	// stopwords set on it must not leak into other indexes.
+	Analyzer *analyzer.Analyzer
+	// StoreOffsets keeps the character offsets of tokens in the postings of
+	// new memtables and segments.
+	StoreOffsets bool
+	// Embedder turns documents and queries into vectors. The fastapi service
+	// pointed to by the EmbeddingHost environment variable is used when nil.
+	Embedder embedding.Embedder
+	// EmbeddingBatchSize is the number of documents embedded per request
+	// when bulk indexing, index.DefaultBatchSize when zero.
+	EmbeddingBatchSize int
+	// EmbeddingWorkers is the number of embedding requests in flight when
+	// bulk indexing, index.DefaultBulkWorkers when zero.
+	EmbeddingWorkers int
+	// Chunker cuts documents into passages with a vector each. Documents
+	// are embedded whole when nil.
+	Chunker chunking.Chunker
+	// SparseEmbedder computes the sparse vectors of documents and queries
+	// that do not bring theirs. Only given sparse vectors are used when nil.
+	SparseEmbedder embedding.SparseEmbedder
+}
+
+// analyzer returns the analyzer of the index. Only configs that did not go
+// through Open fall back to the shared default analyzer, which must never be
+// mutated.
+func (c IndexConfig) analyzer() *analyzer.Analyzer {
+	if c.Analyzer == nil {
+		return analyzer.Default()
+	}
+	return c.Analyzer
+}
+
 type IndexStorage struct {
 	dataStorage *Provider
+	config      IndexConfig
 	memtables   struct {
 		mutable *Memtable
 		queue   []*Memtable
@@ -29,36 +80,57 @@ type IndexStorage struct {
 	segments                   []*FileMetadata
 	invertedIndexSegmentReader []*os.File
 	vectorIndexSegmentReader   []*os.File
-	inMemorySegments           []index.InvertedIndex
+	inMemorySegments           []*index.InvertedIndex
 	inMemoryVectorSegments     []index.HNSW
+	inMemorySparseSegments     []*index.SparseIndex
 	logger                     *slog.Logger
 }
 
-func Open(dirname string, logger *slog.Logger) (*IndexStorage, error) {
+func Open(dirname string, config IndexConfig, logger *slog.Logger) (*IndexStorage, error) {
 	dataStorage, err := NewProvider(dirname)
 	if err != nil {
 		return nil, err
 	}
 
-	db := &IndexStorage{dataStorage: dataStorage, logger: logger}
+	if config.Embedder == nil {
+		config.Embedder = embedding.Default()
+	}
+
+	if config.Analyzer == nil {
+		config.Analyzer, err = analyzer.New(analyzer.DefaultConfig())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db := &IndexStorage{dataStorage: dataStorage, config: config, logger: logger}
+	err = db.loadSynonyms()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.loadStopwords()
+	if err != nil {
+		return nil, err
+	}
+
 	err = db.loadSegments()
 	if err != nil {
 		return nil, err
 	}
-	db.memtables.mutable = NewMemtable(memtableSizeLimit, logger)
+	db.memtables.mutable = NewMemtable(memtableSizeLimit, config, logger)
 	db.memtables.queue = append(db.memtables.queue, db.memtables.mutable)
 
 	return db, nil
 }
 
-func (d *IndexStorage) BulkIndex(docIDs []float64, documents []string) error {
+func (d *IndexStorage) BulkIndex(docIDs []float64, documents []string, vectors [][]float64, sparse []index.SparseVector) error {
 	//ASSUME MEMTABLE CAN FIT THIS REQUEST
 	m := d.memtables.mutable
-	m.BulkIndex(docIDs, documents)
-	return nil
+	return m.BulkIndex(docIDs, documents, vectors, sparse)
 }
 
-func (d *IndexStorage) Index(docID int, document string) error {
+func (d *IndexStorage) Index(docID int, document string, vector []float64, sparse index.SparseVector) error {
 	l := d.memtables.mutable.sizeUsed
 	needed := []byte(document)
 	if l+len(needed) > memtableFlushThreshold {
@@ -71,7 +143,7 @@ func (d *IndexStorage) Index(docID int, document string) error {
 		m = d.rotateMemtables()
 	}
 
-	m.Index(docID, document)
+	m.Index(docID, document, vector, sparse)
 
 	d.maybeScheduleFlush()
 
@@ -83,7 +155,7 @@ func (d *IndexStorage) Index(docID int, document string) error {
 			d.memtables.queue = d.memtables.queue[:len(d.memtables.queue)-1]
 		}
 
-		d.memtables.mutable = NewMemtable(memtableSizeLimit, d.logger)
+		d.memtables.mutable = NewMemtable(memtableSizeLimit, d.config, d.logger)
 		d.memtables.queue = append(d.memtables.queue, d.memtables.mutable)
 	}
 
@@ -91,44 +163,212 @@ func (d *IndexStorage) Index(docID int, document string) error {
 }
 
 func (d *IndexStorage) rotateMemtables() *Memtable {
-	d.memtables.mutable = NewMemtable(memtableSizeLimit, d.logger)
+	d.memtables.mutable = NewMemtable(memtableSizeLimit, d.config, d.logger)
 	d.memtables.queue = append(d.memtables.queue, d.memtables.mutable)
 	return d.memtables.mutable
 }
 
-func (d *IndexStorage) Get(query string, k int) []index.Match {
-	matches := []index.Match{}
-	matchesCh := make(chan []index.Match, len(d.segments))
+// SearchResult holds the best matches of a search. Fallback is set when the
+// query could not be embedded and only full-text search ran, Warning then
+// holds the reason.
+type SearchResult struct {
+	Matches  []index.Match
+	Fallback bool
+	Warning  string
+}
+
+func (d *IndexStorage) Get(ctx context.Context, q index.Query, k int) SearchResult {
+	result := SearchResult{}
 
-	for i := len(d.memtables.queue) - 1; i >= 0; i-- {
-		m := d.memtables.queue[i]
+	//embed the query once for every memtable and segment, an unavailable
+	//embedder degrades the search to full-text only
+	mode := q.SearchMode()
+	if (mode == index.HybridMode || mode == index.SemanticMode) && q.Vector == nil && q.Text != "" {
+		vector, err := d.config.Embedder.Embed(ctx, q.Text)
+		if err != nil {
+			d.logger.Warn("index: embedding query, falling back to full-text search", slog.String("error", err.Error()))
+			result.Fallback, result.Warning = true, err.Error()
+			q.Mode = index.KeywordMode
+		}
+		q.Vector = vector
+	}
 
-		val, _ := m.Get(query, k)
+	//a hybrid search goes on without sparse results when they are missing
+	mode = q.SearchMode()
+	if (mode == index.HybridMode || mode == index.SparseMode) && q.Sparse == nil && q.Text != "" && d.config.SparseEmbedder != nil {
+		sparse, err := d.config.SparseEmbedder.EmbedSparse(ctx, []string{q.Text})
+		if err != nil {
+			d.logger.Warn("index: sparse embedding query", slog.String("error", err.Error()))
+			result.Warning = strings.TrimPrefix(result.Warning+"; "+err.Error(), "; ")
+			if mode == index.SparseMode {
+				result.Fallback = true
+				q.Mode = index.KeywordMode
+			}
+		} else {
+			q.Sparse = sparse[0]
+		}
+	}
 
-		matches = append(matches, val...)
+	//every partition is ranked with the statistics of the whole collection,
+	//so full-text scores of memtables and segments are comparable
+	indexes := []*index.InvertedIndex{}
+	for _, m := range d.memtables.queue {
+		indexes = append(indexes, m.inMemoryInvertedIndex)
 	}
+	indexes = append(indexes, d.inMemorySegments...)
+	stats := index.NewCorpusStatistics(indexes...)
 
-	for j := len(d.segments) - 1; j >= 0; j-- {
-		go func(j int) {
+	candidates := []index.IndexResults{}
+	candidatesCh := make(chan index.IndexResults, len(d.segments))
 
-			h := index.NewHybridSearch(&d.inMemorySegments[j], &d.inMemoryVectorSegments[j], d.logger, index.GetEmbedding)
+	for i := len(d.memtables.queue) - 1; i >= 0; i-- {
+		candidates = append(candidates, d.memtables.queue[i].Candidates(q, k, stats))
+	}
 
-			val, _ := h.Search(query, k)
-			matchesCh <- val
+	for j := len(d.segments) - 1; j >= 0; j-- {
+		go func(j int) {
+			h := index.NewHybridSearch(d.inMemorySegments[j], &d.inMemoryVectorSegments[j], d.logger, d.config.Embedder)
+			h.Sparse = d.inMemorySparseSegments[j]
+			candidatesCh <- h.Candidates(q, k, stats)
 		}(j)
 	}
 
 	for j := len(d.segments) - 1; j >= 0; j-- {
-		r := <-matchesCh
-		matches = append(matches, r...)
+		candidates = append(candidates, <-candidatesCh)
+	}
+
+	//fusing once over the merged candidates keeps a document found in
+	//several partitions from being counted twice
+	merged := index.MergeCandidates(candidates)
+	if q.MMR == nil {
+		result.Matches = index.Fuse(merged, q, k)
+		return result
+	}
+
+	//diversity is picked from a deeper pool than the k results
+	fused := index.Fuse(merged, q, int(math.Max(float64(k), index.DefaultCandidates)))
+	result.Matches = d.Diversify(fused, *q.MMR, k)
+
+	return result
+}
+
+// Diversify picks k of matches by maximal marginal relevance, comparing
+// their documents by the vectors stored for them.
+func (d *IndexStorage) Diversify(matches []index.Match, mmr index.MMR, k int) []index.Match {
+	return index.Diversify(matches, d.vectors(matches), mmr, k)
+}
+
+// vectors returns the stored vectors of the documents of matches, the
+// newest memtable or segment winning for documents indexed several times.
+func (d *IndexStorage) vectors(matches []index.Match) map[int][]float64 {
+	ids := map[int]bool{}
+	for _, match := range matches {
+		ids[int(match.Offsets[0].DocumentID)] = true
+	}
+
+	vectors := map[int][]float64{}
+	for j := range d.inMemoryVectorSegments {
+		for id, vector := range d.inMemoryVectorSegments[j].Vectors(ids) {
+			vectors[id] = vector
+		}
+	}
+
+	for _, m := range d.memtables.queue {
+		for id, vector := range m.inMemoryVectorIndex.Vectors(ids) {
+			vectors[id] = vector
+		}
+	}
+
+	return vectors
+}
+
+// Dimensions returns the size of the vectors of the collection, taken from
+// the first memtable or segment holding vectors, or 0 when there are none.
+func (d *IndexStorage) Dimensions() int {
+	for _, m := range d.memtables.queue {
+		if n := m.inMemoryVectorIndex.Dimensions(); n > 0 {
+			return n
+		}
+	}
+
+	for i := range d.inMemoryVectorSegments {
+		if n := d.inMemoryVectorSegments[i].Dimensions(); n > 0 {
+			return n
+		}
+	}
+
+	return 0
+}
+
+// checkVector returns ErrDimensionMismatch if vector cannot be compared to
+// the vectors of the collection.
+func (d *IndexStorage) checkVector(vector []float64) error {
+	if vector == nil {
+		return nil
 	}
 
-	sort.Slice(matches, func(i, j int) bool {
-		return matches[i].Score > matches[j].Score
-	})
+	if len(vector) == 0 {
+		return fmt.Errorf("%w: empty vector", ErrDimensionMismatch)
+	}
+
+	if n := d.Dimensions(); n > 0 && len(vector) != n {
+		return fmt.Errorf("%w: got %d, expected %d", ErrDimensionMismatch, len(vector), n)
+	}
 
-	k = int(math.Min(float64(k), float64(len(matches))))
-	return matches[:k]
+	return nil
+}
+
+// Suggest proposes up to n corrected queries using the term dictionaries and
+// document frequencies of every memtable and segment.
+func (d *IndexStorage) Suggest(query string, n int) []string {
+	indexes := []*index.InvertedIndex{}
+
+	for _, m := range d.memtables.queue {
+		indexes = append(indexes, m.inMemoryInvertedIndex)
+	}
+
+	indexes = append(indexes, d.inMemorySegments...)
+
+	return index.NewSuggester(d.config.analyzer(), indexes).Suggest(query, n)
+}
+
+// Highlighter returns a highlighter analyzing documents the way they were
+// indexed.
+func (d *IndexStorage) Highlighter() *index.Highlighter {
+	return index.NewHighlighter(d.config.analyzer())
+}
+
+// Complete returns the n heaviest completions of prefix, summing word weights
+// across every memtable and segment.
+func (d *IndexStorage) Complete(prefix string, n int) []index.CompletionTerm {
+	completions := []*index.Completion{}
+
+	for _, m := range d.memtables.queue {
+		completions = append(completions, &m.inMemoryInvertedIndex.Completion)
+	}
+
+	for _, s := range d.inMemorySegments {
+		completions = append(completions, &s.Completion)
+	}
+
+	//every match of every partition is summed before truncating, a word
+	//spread thinly over many partitions may outweigh one concentrated in one
+	weights := map[string]int{}
+	for _, c := range completions {
+		for _, t := range c.Matches(prefix) {
+			weights[t.Term] += t.Weight
+		}
+	}
+
+	terms := []index.CompletionTerm{}
+	for term, weight := range weights {
+		terms = append(terms, index.CompletionTerm{Term: term, Weight: weight})
+	}
+
+	index.SortCompletions(terms)
+
+	n = int(math.Min(float64(n), float64(len(terms))))
+	return terms[:n]
 }
 
 func (d *IndexStorage) maybeScheduleFlush() {
@@ -184,6 +424,39 @@ func (d *IndexStorage) FlushMemtables() error {
 			return err
 		}
 
+		completionBytes, err := flushable[i].inMemoryInvertedIndex.Completion.Encode()
+
+		if err != nil {
+			return err
+		}
+
+		err = d.writeSegment(completionBytes, meta, CompletionSegmentPath)
+		if err != nil {
+			return err
+		}
+
+		metadataBytes, err := flushable[i].inMemoryInvertedIndex.Metadata().Encode()
+
+		if err != nil {
+			return err
+		}
+
+		err = d.writeSegment(metadataBytes, meta, MetadataSegmentPath)
+		if err != nil {
+			return err
+		}
+
+		sparseBytes, err := flushable[i].inMemorySparseIndex.Encode()
+
+		if err != nil {
+			return err
+		}
+
+		err = d.writeSegment(sparseBytes, meta, SparseIndexSegmentPath)
+		if err != nil {
+			return err
+		}
+
 		d.segments = append(d.segments, meta)
 	}
 	return nil
@@ -226,7 +499,21 @@ func (d *IndexStorage) loadSegments() error {
 		if err != nil {
 			return err
 		}
-		d.inMemorySegments = append(d.inMemorySegments, *invertedIndex)
+		invertedIndex.MaxExpansions = d.config.MaxExpansions
+		invertedIndex.SetAnalyzer(d.config.analyzer())
+
+		if err := d.loadCompletion(f, &invertedIndex.Completion); err != nil {
+			return err
+		}
+
+		metadata, err := d.loadMetadata(f)
+		if err != nil {
+			return err
+		}
+		invertedIndex.SetMetadata(*metadata)
+		d.checkMetadata(f, metadata)
+
+		d.inMemorySegments = append(d.inMemorySegments, invertedIndex)
 
 		reader, err = d.dataStorage.OpenFileForReading(f, VectorIndexSegmentPath)
 		if err != nil {
@@ -242,11 +529,113 @@ func (d *IndexStorage) loadSegments() error {
 		}
 
 		d.inMemoryVectorSegments = append(d.inMemoryVectorSegments, *vectorIndex)
+
+		sparseIndex, err := d.loadSparseIndex(f)
+		if err != nil {
+			return err
+		}
+
+		d.inMemorySparseSegments = append(d.inMemorySparseSegments, sparseIndex)
 	}
 
 	return nil
 }
 
+// checkMetadata warns about segments analyzed differently from the current
+// analyzer: their terms are inconsistent with those of new documents and
+// queries until they are reindexed. Segments written before metadata was
+// persisted are not checked.
+func (d *IndexStorage) checkMetadata(f *FileMetadata, metadata *index.Metadata) {
+	if metadata.Analyzer.Tokenizer.Type == "" {
+		return
+	}
+
+	a := d.config.analyzer()
+
+	if !metadata.Analyzer.Equal(a.Config()) {
+		d.logger.Warn("segment was indexed with a different analyzer config, reindex for consistent matching",
+			slog.Int("segment", f.FileNum()),
+			slog.String("indexed", metadata.Analyzer.String()),
+			slog.String("current", a.Config().String()))
+	}
+
+	if metadata.Normalization != a.Normalization() {
+		d.logger.Warn("segment was indexed with a different unicode normalization, reindex for consistent matching",
+			slog.Int("segment", f.FileNum()),
+			slog.String("indexed", metadata.Normalization),
+			slog.String("current", a.Normalization()))
+	}
+
+	if metadata.Stopwords != "" && metadata.Stopwords != a.StopwordsFingerprint() {
+		d.logger.Warn("segment was indexed with different stopwords, reindex for consistent matching",
+			slog.Int("segment", f.FileNum()),
+			slog.String("indexed", metadata.Stopwords),
+			slog.String("current", a.StopwordsFingerprint()))
+	}
+}
+
+// empty reports whether no document has been indexed yet.
+func (d *IndexStorage) empty() bool {
+	for _, m := range d.memtables.queue {
+		if len(m.inMemoryInvertedIndex.PostingsList) > 0 {
+			return false
+		}
+	}
+	return len(d.segments) == 0
+}
+
+// loadCompletion reads the completion structure of a segment into c.
+// Segments written before completions were persisted leave it empty.
+func (d *IndexStorage) loadCompletion(f *FileMetadata, c *index.Completion) error {
+	reader, err := d.dataStorage.OpenFileForReading(f, CompletionSegmentPath)
+	if errors.Is(err, os.ErrNotExist) {
+		c.Weights = map[string]int{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	r := NewReader(reader)
+	defer r.Close()
+
+	return r.loadCompletion(c)
+}
+
+// loadSparseIndex reads the sparse vectors of a segment. Segments written
+// before sparse vectors were persisted get an empty index.
+func (d *IndexStorage) loadSparseIndex(f *FileMetadata) (*index.SparseIndex, error) {
+	reader, err := d.dataStorage.OpenFileForReading(f, SparseIndexSegmentPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return index.NewSparseIndex(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewReader(reader)
+	defer r.Close()
+
+	return r.loadSparseIndex()
+}
+
+// loadMetadata reads how a segment was analyzed. Segments written before
+// metadata was persisted get an empty one.
+func (d *IndexStorage) loadMetadata(f *FileMetadata) (*index.Metadata, error) {
+	reader, err := d.dataStorage.OpenFileForReading(f, MetadataSegmentPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return &index.Metadata{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewReader(reader)
+	defer r.Close()
+
+	return r.loadMetadata()
+}
+
 func (d *IndexStorage) writeSegment(b []byte, meta *FileMetadata, indexType string) error {
 	f, err := d.dataStorage.OpenFileForWriting(meta, indexType)
 	if err != nil {
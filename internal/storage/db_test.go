@@ -1,14 +1,17 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"log/slog"
 	"testing"
+
+	"github.com/farouqzaib/fast-search/internal/index"
 )
 
 func TestDB(t *testing.T) {
-	d, err := Open("demo-vector", slog.Default())
+	d, err := Open("demo-vector", IndexConfig{}, slog.Default())
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -20,5 +23,5 @@ func TestDB(t *testing.T) {
 
 	// fmt.Println(d.memtables.mutable.sizeUsed)
 
-	fmt.Println(d.Get("years of experience", 10))
+	fmt.Println(d.Get(context.Background(), index.Query{Text: "years of experience"}, 10))
 }
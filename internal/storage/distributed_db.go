@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/farouqzaib/fast-search/internal/analyzer"
 	"github.com/farouqzaib/fast-search/internal/index"
 	"github.com/hashicorp/raft"
 	raftboltdb "github.com/hashicorp/raft-boltdb"
@@ -39,7 +41,7 @@ func NewDistributedDB(dataDir string, config Config, logger *slog.Logger) (*Dist
 }
 
 func (d *DistributedDB) setupIndex(dataDir string) error {
-	db, err := Open(dataDir, d.logger)
+	db, err := Open(dataDir, d.config.Index, d.logger)
 	if err != nil {
 		return err
 	}
@@ -142,14 +144,27 @@ type Config struct {
 		StreamLayer *raft.StreamLayer
 		Bootstrap   bool
 	}
+	Index   IndexConfig
 	Addr    string
 	RaftDir string
 }
 
-func (d *DistributedDB) Index(docId int, document string) error {
+// CheckVector returns ErrDimensionMismatch if vector cannot be compared to
+// the vectors of the collection.
+func (d *DistributedDB) CheckVector(vector []float64) error {
+	return d.DB.checkVector(vector)
+}
+
+// Index replicates a document to every node. vector and sparse are the
+// precomputed vectors of the document, nil to embed its text.
+func (d *DistributedDB) Index(docId int, document string, vector []float64, sparse index.SparseVector) error {
+	if err := d.DB.checkVector(vector); err != nil {
+		return err
+	}
+
 	c := &command{
 		Op:   "index",
-		Data: map[string]interface{}{"docId": docId, "document": document},
+		Data: map[string]interface{}{"docId": docId, "document": document, "vector": vector, "sparse": sparse},
 	}
 
 	b, err := json.Marshal(c)
@@ -172,10 +187,31 @@ func (d *DistributedDB) Index(docId int, document string) error {
 	return nil
 }
 
-func (d *DistributedDB) BulkIndex(docIds []int, documents []string) error {
+// BulkIndex replicates documents to every node. vectors is either nil or
+// holds the precomputed vector of each document, nil for those to embed, and
+// sparse their sparse vectors likewise.
+func (d *DistributedDB) BulkIndex(docIds []int, documents []string, vectors [][]float64, sparse []index.SparseVector) error {
+	dimensions := 0
+	for i, vector := range vectors {
+		if err := d.DB.checkVector(vector); err != nil {
+			return fmt.Errorf("document %d: %w", i, err)
+		}
+
+		//vectors of the same request must agree with each other too
+		if vector == nil {
+			continue
+		}
+		if dimensions == 0 {
+			dimensions = len(vector)
+		}
+		if len(vector) != dimensions {
+			return fmt.Errorf("document %d: %w: got %d, expected %d", i, ErrDimensionMismatch, len(vector), dimensions)
+		}
+	}
+
 	c := &command{
 		Op:   "bulkIndex",
-		Data: map[string]interface{}{"docIds": docIds, "documents": documents},
+		Data: map[string]interface{}{"docIds": docIds, "documents": documents, "vectors": vectors, "sparse": sparse},
 	}
 
 	b, err := json.Marshal(c)
@@ -198,16 +234,114 @@ func (d *DistributedDB) BulkIndex(docIds []int, documents []string) error {
 	return nil
 }
 
-func (d *DistributedDB) Search(query string, k int) ([]index.Match, error) {
-	res := d.DB.Get(query, 10)
+func (d *DistributedDB) Search(ctx context.Context, q index.Query, k int) (SearchResult, error) {
+	if err := d.DB.checkVector(q.Vector); err != nil {
+		return SearchResult{Matches: []index.Match{}}, err
+	}
+
+	res := d.DB.Get(ctx, q, k)
 
 	return res, nil
 }
 
+func (d *DistributedDB) Suggest(query string, n int) []string {
+	return d.DB.Suggest(query, n)
+}
+
+func (d *DistributedDB) Synonyms() ([]string, error) {
+	return d.DB.Synonyms()
+}
+
+// SetSynonyms replicates new synonym rules to every node. Rules are checked
+// before they are replicated so a bad rule is never committed to the log.
+func (d *DistributedDB) SetSynonyms(rules []string) error {
+	if d.DB.config.analyzer().Synonyms() == nil {
+		return ErrNoSynonymFilter
+	}
+
+	if _, err := analyzer.NewSynonymSet(rules); err != nil {
+		return err
+	}
+
+	c := &command{
+		Op:   "synonyms",
+		Data: map[string]interface{}{"rules": rules},
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	timeout := 10 * time.Second
+	future := d.raft.Apply(b, timeout)
+
+	if future.Error() != nil {
+		return future.Error()
+	}
+
+	res := future.Response()
+	if err, ok := res.(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+func (d *DistributedDB) Stopwords() (Stopwords, error) {
+	return d.DB.Stopwords()
+}
+
+// SetStopwords replicates new stopwords to every node. It returns a warning
+// when documents already indexed need to be reindexed.
+func (d *DistributedDB) SetStopwords(s Stopwords) (string, error) {
+	if d.DB.config.analyzer().Stopwords() == nil {
+		return "", ErrNoStopFilter
+	}
+
+	c := &command{
+		Op:   "stopwords",
+		Data: map[string]interface{}{"words": s.Words, "disabled": s.Disabled},
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	timeout := 10 * time.Second
+	future := d.raft.Apply(b, timeout)
+
+	if future.Error() != nil {
+		return "", future.Error()
+	}
+
+	switch res := future.Response().(type) {
+	case error:
+		return "", res
+	case string:
+		return res, nil
+	}
+
+	return "", nil
+}
+
+func (d *DistributedDB) Highlight(document, query string, offsets []index.Position) index.Highlight {
+	return d.DB.Highlighter().Highlight(document, query, offsets)
+}
+
+func (d *DistributedDB) Diversify(matches []index.Match, mmr index.MMR, k int) []index.Match {
+	return d.DB.Diversify(matches, mmr, k)
+}
+
+func (d *DistributedDB) Complete(prefix string, n int) []index.CompletionTerm {
+	return d.DB.Complete(prefix, n)
+}
+
 func (d *DistributedDB) Join(nodeID, addr string) error {
 	configFuture := d.raft.GetConfiguration()
 	if err := configFuture.Error(); err != nil {
-		d.logger.Error("failed to get raft configuration: %v", err)
+		d.logger.Error("failed to get raft configuration", slog.String("error", err.Error()))
 		return err
 	}
 
@@ -274,7 +408,7 @@ func (f *fsm) Apply(b *raft.Log) interface{} {
 	case "index":
 		docId := int(c.Data["docId"].(float64))
 		document := c.Data["document"].(string)
-		return f.applyIndex(docId, document)
+		return f.applyIndex(docId, document, toVector(c.Data["vector"]), toSparseVector(c.Data["sparse"]))
 	case "search":
 		query := c.Data["query"].(string)
 		return f.applySearch(query)
@@ -292,14 +426,46 @@ func (f *fsm) Apply(b *raft.Log) interface{} {
 		for _, d := range rawDocuments {
 			documents = append(documents, d.(string))
 		}
-		return f.applyBulkIndex(docIds, documents)
+
+		var vectors [][]float64
+		if rawVectors, ok := c.Data["vectors"].([]interface{}); ok {
+			for _, v := range rawVectors {
+				vectors = append(vectors, toVector(v))
+			}
+		}
+
+		var sparse []index.SparseVector
+		if rawSparse, ok := c.Data["sparse"].([]interface{}); ok {
+			for _, v := range rawSparse {
+				sparse = append(sparse, toSparseVector(v))
+			}
+		}
+		return f.applyBulkIndex(docIds, documents, vectors, sparse)
+	case "synonyms":
+		rules := []string{}
+		if rawRules, ok := c.Data["rules"].([]interface{}); ok {
+			for _, r := range rawRules {
+				rules = append(rules, r.(string))
+			}
+		}
+		return f.applySynonyms(rules)
+	case "stopwords":
+		var s Stopwords
+		if rawWords, ok := c.Data["words"].([]interface{}); ok {
+			s.Words = []string{}
+			for _, w := range rawWords {
+				s.Words = append(s.Words, w.(string))
+			}
+		}
+		s.Disabled, _ = c.Data["disabled"].(bool)
+		return f.applyStopwords(s)
 	default:
 		panic(fmt.Sprintf("unrecognized command op: %s", c.Op))
 	}
 }
 
-func (f *fsm) applyBulkIndex(docIds []float64, documents []string) interface{} {
-	err := f.db.BulkIndex(docIds, documents)
+func (f *fsm) applyBulkIndex(docIds []float64, documents []string, vectors [][]float64, sparse []index.SparseVector) interface{} {
+	err := f.db.BulkIndex(docIds, documents, vectors, sparse)
 	if err != nil {
 		return err
 	}
@@ -307,8 +473,8 @@ func (f *fsm) applyBulkIndex(docIds []float64, documents []string) interface{} {
 	return nil
 }
 
-func (f *fsm) applyIndex(docId int, document string) interface{} {
-	err := f.db.Index(docId, document)
+func (f *fsm) applyIndex(docId int, document string, vector []float64, sparse index.SparseVector) interface{} {
+	err := f.db.Index(docId, document, vector, sparse)
 	if err != nil {
 		return err
 	}
@@ -316,8 +482,57 @@ func (f *fsm) applyIndex(docId int, document string) interface{} {
 	return nil
 }
 
+// toVector converts a vector decoded from a JSON command, nil if absent.
+func toVector(raw interface{}) []float64 {
+	values, ok := raw.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	vector := make([]float64, len(values))
+	for i, v := range values {
+		vector[i] = v.(float64)
+	}
+
+	return vector
+}
+
+// toSparseVector converts a sparse vector decoded from a JSON command, nil
+// if absent.
+func toSparseVector(raw interface{}) index.SparseVector {
+	values, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	sparse := index.SparseVector{}
+	for term, weight := range values {
+		sparse[term] = weight.(float64)
+	}
+
+	return sparse
+}
+
+func (f *fsm) applySynonyms(rules []string) interface{} {
+	err := f.db.SetSynonyms(rules)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (f *fsm) applyStopwords(s Stopwords) interface{} {
+	warning, err := f.db.SetStopwords(s)
+	if err != nil {
+		return err
+	}
+
+	return warning
+}
+
 func (f *fsm) applySearch(query string) interface{} {
-	res := f.db.Get(query, 10)
+	res := f.db.Get(context.Background(), index.Query{Text: query}, 10)
 
 	return res
 }
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log/slog"
@@ -8,6 +9,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/farouqzaib/fast-search/internal/embedding"
+	"github.com/farouqzaib/fast-search/internal/index"
+	"github.com/farouqzaib/fast-search/internal/rerank"
 	"github.com/hashicorp/raft"
 	"github.com/stretchr/testify/require"
 )
@@ -58,15 +62,64 @@ func TestDistributedDB(t *testing.T) {
 	documents := map[int]string{1: "still works", 8: "raft can be so much fun!"}
 
 	for k, v := range documents {
-		err := dbs[0].Index(k, v)
+		err := dbs[0].Index(k, v, nil, nil)
 		require.NoError(t, err)
 	}
 
 	require.Eventually(t, func() bool {
 		for j := 0; j < nodeCount; j++ {
-			got, err := dbs[j].Search("raft", 10)
+			got, err := dbs[j].Search(context.Background(), index.Query{Text: "raft"}, 10)
 			fmt.Println(got, err)
 		}
 		return true
 	}, 5*time.Second, 1*time.Second)
 }
+
+type recordingReranker struct {
+	documents []string
+}
+
+func (r *recordingReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	r.documents = documents
+	return make([]float64, len(documents)), nil
+}
+
+func TestDistributedDBSearchRerankCandidates(t *testing.T) {
+	dataDir := t.TempDir()
+
+	config := Config{}
+	config.Raft.LocalID = raft.ServerID("0")
+	config.Raft.Bootstrap = true
+	config.Addr = "127.0.0.1:9010"
+	config.RaftDir = dataDir
+	config.Index.Embedder = embedding.NewHashing(8)
+
+	d, err := NewDistributedDB(dataDir, config, slog.Default())
+	require.NoError(t, err)
+	require.NoError(t, d.WaitForLeader(5*time.Second))
+
+	docIds, documents := []int{}, []string{}
+	for i := 1; i <= 15; i++ {
+		docIds = append(docIds, i)
+		documents = append(documents, fmt.Sprintf("raft document %d", i))
+	}
+	require.NoError(t, d.BulkIndex(docIds, documents, nil, nil))
+
+	//the reranker sees topN candidates, not only the first page
+	topN := 12
+	result, err := d.Search(context.Background(), index.Query{Text: "raft", Mode: index.KeywordMode}, topN)
+	require.NoError(t, err)
+
+	texts := []string{}
+	for _, match := range result.Matches {
+		texts = append(texts, documents[int(match.Offsets[0].DocumentID)-1])
+	}
+
+	r := &recordingReranker{}
+	_, err = rerank.Matches(context.Background(), r, "raft", result.Matches, texts, topN)
+	require.NoError(t, err)
+
+	if len(r.documents) != topN {
+		t.Fatalf("expected %v, got %v", topN, len(r.documents))
+	}
+}
@@ -1,8 +1,11 @@
 package storage
 
 import (
+	"context"
 	"log/slog"
 
+	"github.com/farouqzaib/fast-search/internal/chunking"
+	"github.com/farouqzaib/fast-search/internal/embedding"
 	"github.com/farouqzaib/fast-search/internal/index"
 )
 
@@ -11,19 +14,35 @@ import (
 type Memtable struct {
 	inMemoryInvertedIndex *index.InvertedIndex
 	inMemoryVectorIndex   *index.HNSW
+	inMemorySparseIndex   *index.SparseIndex
 	sizeUsed              int
 	sizeLimit             int
+	embedder              embedding.Embedder
+	batchSize             int
+	workers               int
+	chunker               chunking.Chunker
+	sparseEmbedder        embedding.SparseEmbedder
 	logger                *slog.Logger
 }
 
-func NewMemtable(sizeLimit int, logger *slog.Logger) *Memtable {
+func NewMemtable(sizeLimit int, config IndexConfig, logger *slog.Logger) *Memtable {
 	m := &Memtable{
 		inMemoryInvertedIndex: index.NewInvertedIndex(),
 		inMemoryVectorIndex:   index.NewHNSW(5, 0.62, 2, 16),
+		inMemorySparseIndex:   index.NewSparseIndex(),
 		sizeLimit:             sizeLimit,
+		embedder:              config.Embedder,
+		batchSize:             config.EmbeddingBatchSize,
+		workers:               config.EmbeddingWorkers,
+		chunker:               config.Chunker,
+		sparseEmbedder:        config.SparseEmbedder,
 		logger:                logger,
 	}
 
+	m.inMemoryInvertedIndex.MaxExpansions = config.MaxExpansions
+	m.inMemoryInvertedIndex.SetAnalyzer(config.analyzer())
+	m.inMemoryInvertedIndex.StoreOffsets = config.StoreOffsets
+
 	return m
 }
 
@@ -40,15 +59,21 @@ func (m *Memtable) HasRoomForWrite(data []byte) bool {
 		panic(err)
 	}
 
-	sizeNeeded := len(invertedIndexBytes) + len(hnswBytes) + len(data)
+	sparseBytes, err := m.inMemorySparseIndex.Encode()
+
+	if err != nil {
+		panic(err)
+	}
+
+	sizeNeeded := len(invertedIndexBytes) + len(hnswBytes) + len(sparseBytes) + len(data)
 	sizeAvailable := m.sizeLimit - m.sizeUsed
 
 	return sizeNeeded <= sizeAvailable
 }
 
-func (m *Memtable) Index(docID int, document string) error {
-	h := index.NewHybridSearch(m.inMemoryInvertedIndex, m.inMemoryVectorIndex, m.logger, index.GetEmbedding)
-	err := h.Index(docID, document)
+func (m *Memtable) Index(docID int, document string, vector []float64, sparse index.SparseVector) error {
+	h := m.hybridSearch()
+	err := h.Index(context.Background(), docID, document, vector, sparse)
 
 	if err != nil {
 		return err
@@ -59,9 +84,9 @@ func (m *Memtable) Index(docID int, document string) error {
 	return nil
 }
 
-func (m *Memtable) BulkIndex(docIDs []float64, documents []string) error {
-	h := index.NewHybridSearch(m.inMemoryInvertedIndex, m.inMemoryVectorIndex, m.logger, index.GetEmbedding)
-	err := h.BulkIndex(docIDs, documents)
+func (m *Memtable) BulkIndex(docIDs []float64, documents []string, vectors [][]float64, sparse []index.SparseVector) error {
+	h := m.hybridSearch()
+	err := h.BulkIndex(context.Background(), docIDs, documents, vectors, sparse)
 
 	if err != nil {
 		return err
@@ -76,16 +101,17 @@ func (m *Memtable) BulkIndex(docIDs []float64, documents []string) error {
 	return nil
 }
 
-func (m *Memtable) Get(query string, k int) ([]index.Match, error) {
-	h := index.NewHybridSearch(m.inMemoryInvertedIndex, m.inMemoryVectorIndex, m.logger, index.GetEmbedding)
-
-	matches, err := h.Search(query, k)
-
-	if err != nil {
-		return []index.Match{}, err
-	}
+// Candidates returns the unfused matches of q in the memtable, weighting
+// terms by stats.
+func (m *Memtable) Candidates(q index.Query, k int, stats index.Statistics) index.IndexResults {
+	return m.hybridSearch().Candidates(q, k, stats)
+}
 
-	return matches, nil
+func (m *Memtable) hybridSearch() *index.HybridSearch {
+	h := index.NewHybridSearch(m.inMemoryInvertedIndex, m.inMemoryVectorIndex, m.logger, m.embedder)
+	h.BatchSize, h.Workers, h.Chunker = m.batchSize, m.workers, m.chunker
+	h.Sparse, h.SparseEmbedder = m.inMemorySparseIndex, m.sparseEmbedder
+	return h
 }
 
 func (m *Memtable) Size() int {
@@ -52,6 +52,21 @@ func (s *Provider) ensureDataDirExists() error {
 	if err != nil {
 		return err
 	}
+
+	err = os.MkdirAll(filepath.Join(s.dataDir, CompletionSegmentPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Join(s.dataDir, MetadataSegmentPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Join(s.dataDir, SparseIndexSegmentPath), 0755)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
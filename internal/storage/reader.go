@@ -72,6 +72,64 @@ func (r *Reader) loadVectorIndex() (*index.HNSW, error) {
 	return &i, nil
 }
 
+func (r *Reader) loadCompletion(c *index.Completion) error {
+	reader, err := gzip.NewReader(r.br)
+	if err != nil {
+		return err
+	}
+
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	return c.Decode(b)
+}
+
+func (r *Reader) loadMetadata() (*index.Metadata, error) {
+	reader, err := gzip.NewReader(r.br)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var m index.Metadata
+
+	err = m.Decode(b)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func (r *Reader) loadSparseIndex() (*index.SparseIndex, error) {
+	reader, err := gzip.NewReader(r.br)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	s := index.NewSparseIndex()
+
+	err = s.Decode(b)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
 func (r *Reader) Close() error {
 	err := r.file.Close()
 	if err != nil {
@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/farouqzaib/fast-search/internal/chunking"
+	"github.com/farouqzaib/fast-search/internal/embedding"
+	"github.com/farouqzaib/fast-search/internal/index"
+)
+
+func TestGetMergesPartitions(t *testing.T) {
+	d, err := Open(t.TempDir(), IndexConfig{Embedder: embedding.NewHashing(64)}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	d.Index(2, "raft consensus", nil, nil)
+	d.Index(1, "raft is a protocol reaching consensus", nil, nil)
+	d.rotateMemtables()
+	d.Index(1, "raft is a protocol reaching consensus", nil, nil)
+	d.Index(3, "paxos", nil, nil)
+
+	result := d.Get(context.Background(), index.Query{Text: "raft consensus"}, 10)
+
+	seen := map[float64]bool{}
+	for _, match := range result.Matches {
+		id := match.Offsets[0].DocumentID
+		if seen[id] {
+			t.Fatalf("expected document %v once, got %v", id, result.Matches)
+		}
+		seen[id] = true
+	}
+
+	//document 2 is the best match of its partition and of the collection
+	result = d.Get(context.Background(), index.Query{Text: "raft consensus"}, 1)
+	if len(result.Matches) != 1 || result.Matches[0].Offsets[0].DocumentID != 2 {
+		t.Fatalf("expected %v, got %v", 2, result.Matches)
+	}
+}
+
+func TestGetCorpusStatistics(t *testing.T) {
+	d, err := Open(t.TempDir(), IndexConfig{Embedder: embedding.NewHashing(8)}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	//"gotham" is rare in the collection although it fills the newest memtable
+	d.Index(1, "save gotham", nil, nil)
+	d.Index(2, "save the city", nil, nil)
+	d.Index(3, "save the world", nil, nil)
+	d.rotateMemtables()
+	d.Index(4, "save gotham", nil, nil)
+
+	q := index.Query{Text: "gotham", Mode: index.KeywordMode}
+	global := d.Get(context.Background(), q, 10)
+
+	local := d.memtables.mutable.inMemoryInvertedIndex.RankProximity("gotham", 10)
+
+	if len(global.Matches) != 2 || len(local) != 1 {
+		t.Fatalf("expected %v and %v matches, got %v and %v", 2, 1, global.Matches, local)
+	}
+
+	if global.Matches[0].Score <= local[0].Score {
+		t.Fatalf("expected the collection idf %v to exceed the memtable idf %v", global.Matches[0].Score, local[0].Score)
+	}
+}
+
+func TestGetMMR(t *testing.T) {
+	d, err := Open(t.TempDir(), IndexConfig{Embedder: embedding.NewHashing(64)}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	//the same article ingested twice
+	d.Index(1, "raft consensus keeps replicated logs in sync", nil, nil)
+	d.Index(2, "raft consensus keeps replicated logs in sync", nil, nil)
+	d.Index(3, "raft elects a leader", nil, nil)
+
+	q := index.Query{Text: "raft", Mode: index.KeywordMode}
+	if result := d.Get(context.Background(), q, 2); result.Matches[1].Offsets[0].DocumentID == 3 {
+		t.Fatalf("expected the duplicate to rank second without mmr, got %v", result.Matches)
+	}
+
+	q.MMR = &index.MMR{Lambda: 0.5}
+	result := d.Get(context.Background(), q, 2)
+
+	if len(result.Matches) != 2 || result.Matches[1].Offsets[0].DocumentID != 3 {
+		t.Fatalf("expected %v second, got %v", 3, result.Matches)
+	}
+
+	//reranked hits are diversified by their reranked scores
+	reranked := []index.Match{
+		{Offsets: []index.Position{{DocumentID: 2}}, Score: 0.9},
+		{Offsets: []index.Position{{DocumentID: 1}}, Score: 0.8},
+		{Offsets: []index.Position{{DocumentID: 3}}, Score: 0.1},
+	}
+
+	diversified := d.Diversify(reranked, index.MMR{Lambda: 0.3}, 2)
+	if len(diversified) != 2 || diversified[0].Offsets[0].DocumentID != 2 || diversified[1].Offsets[0].DocumentID != 3 {
+		t.Fatalf("expected %v, got %v", []float64{2, 3}, diversified)
+	}
+}
+
+func TestGetPassage(t *testing.T) {
+	d, err := Open(t.TempDir(), IndexConfig{Embedder: embedding.NewHashing(64), Chunker: chunking.NewSentences(8)}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	document := "Tell me, O muse, of that ingenious hero. He travelled far and wide after he had sacked Troy. Many cities did he visit."
+	d.Index(1, document, nil, nil)
+
+	q := index.Query{Text: "many cities did he visit", Mode: index.SemanticMode}
+	result := d.Get(context.Background(), q, 10)
+
+	if len(result.Matches) != 1 {
+		t.Fatalf("expected %v, got %v", 1, result.Matches)
+	}
+
+	passage := result.Matches[0].Passage
+	if passage == nil || document[passage.Start:passage.End] != "Many cities did he visit." {
+		t.Fatalf("expected %q, got %v", "Many cities did he visit.", passage)
+	}
+}
+
+type termEmbedder struct{}
+
+// EmbedSparse weighs every word of a text by its position from the end, so
+// the first word counts the most.
+func (termEmbedder) EmbedSparse(ctx context.Context, texts []string) ([]map[string]float64, error) {
+	r := []map[string]float64{}
+	for _, text := range texts {
+		words := strings.Fields(text)
+		weights := map[string]float64{}
+		for i, word := range words {
+			weights[word] += float64(len(words) - i)
+		}
+		r = append(r, weights)
+	}
+	return r, nil
+}
+
+func TestGetSparse(t *testing.T) {
+	dir := t.TempDir()
+	config := IndexConfig{Embedder: embedding.NewHashing(8), SparseEmbedder: termEmbedder{}}
+
+	d, err := Open(dir, config, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	d.Index(1, "consensus raft", nil, nil)
+	d.Index(2, "raft consensus", nil, nil)
+	//a given sparse vector is kept as is
+	d.Index(3, "paxos", nil, index.SparseVector{"raft": 10})
+
+	q := index.Query{Text: "raft", Mode: index.SparseMode}
+	result := d.Get(context.Background(), q, 10)
+
+	expected := []float64{3, 2, 1}
+	if got := matchIDs(result.Matches); !equalIDs(got, expected) || result.Fallback {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	d.rotateMemtables()
+	if err := d.FlushMemtables(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = Open(dir, config, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	if len(d.segments) != 1 {
+		t.Fatalf("expected %v, got %v", 1, len(d.segments))
+	}
+
+	result = d.Get(context.Background(), q, 10)
+	if got := matchIDs(result.Matches); !equalIDs(got, expected) {
+		t.Fatalf("expected %v after a flush, got %v", expected, got)
+	}
+}
+
+func matchIDs(matches []index.Match) []float64 {
+	r := []float64{}
+	for _, m := range matches {
+		r = append(r, m.Offsets[0].DocumentID)
+	}
+	return r
+}
+
+func equalIDs(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGetFuzzyFallbackGlobal(t *testing.T) {
+	d, err := Open(t.TempDir(), IndexConfig{Embedder: embedding.NewHashing(8)}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	d.Index(1, "gotham city", nil, nil)
+	d.rotateMemtables()
+	d.Index(2, "gorham city", nil, nil)
+
+	//gotham is in the collection, so the memtable without it must not match
+	//it fuzzily
+	q := index.Query{Text: "gotham", Mode: index.KeywordMode}
+	result := d.Get(context.Background(), q, 10)
+
+	if got := matchIDs(result.Matches); !equalIDs(got, []float64{1}) {
+		t.Fatalf("expected %v, got %v", []float64{1}, got)
+	}
+
+	q.Text = "gothem"
+	result = d.Get(context.Background(), q, 10)
+
+	if got := matchIDs(result.Matches); len(got) != 2 {
+		t.Fatalf("expected a term missing from the collection to match fuzzily, got %v", got)
+	}
+}
+
+func TestCompleteAcrossPartitions(t *testing.T) {
+	d, err := Open(t.TempDir(), IndexConfig{Embedder: embedding.NewHashing(8)}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	//gothic is never the heaviest word of a partition but is of the collection
+	id := 0
+	for i, word := range []string{"gotham", "goths", "gotha", "gothenburg"} {
+		if i > 0 {
+			d.rotateMemtables()
+		}
+		id++
+		d.Index(id, word+" gothic", nil, nil)
+		id++
+		d.Index(id, word, nil, nil)
+	}
+
+	got := d.Complete("goth", 1)
+
+	if len(got) != 1 || got[0].Term != "gothic" || got[0].Weight != 4 {
+		t.Fatalf("expected %v, got %v", index.CompletionTerm{Term: "gothic", Weight: 4}, got)
+	}
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+const StopwordsFile = "stopwords.json"
+
+var ErrNoStopFilter = errors.New("analyzer has no stop filter")
+
+// Stopwords is the stopword configuration of an index. Nil words stand for
+// the stopwords of the analyzed language.
+type Stopwords struct {
+	Words    []string `json:"words"`
+	Disabled bool     `json:"disabled"`
+}
+
+// Stopwords returns the stopwords of the analyzer.
+func (d *IndexStorage) Stopwords() (Stopwords, error) {
+	set := d.config.analyzer().Stopwords()
+	if set == nil {
+		return Stopwords{}, ErrNoStopFilter
+	}
+
+	return Stopwords{Words: set.Words(), Disabled: set.Disabled()}, nil
+}
+
+// SetStopwords replaces the stopwords of the analyzer and persists them so
+// they survive restarts. Documents already indexed keep the stopwords they
+// were analyzed with, so a warning is returned when the change leaves them
+// inconsistent with new documents and queries.
+func (d *IndexStorage) SetStopwords(s Stopwords) (string, error) {
+	set := d.config.analyzer().Stopwords()
+	if set == nil {
+		return "", ErrNoStopFilter
+	}
+
+	before := set.Fingerprint()
+	set.Set(s.Words)
+	set.SetDisabled(s.Disabled)
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	//write then rename so a crash never leaves a truncated file behind
+	path := filepath.Join(d.dataStorage.dataDir, StopwordsFile)
+	if err := os.WriteFile(path+".tmp", b, 0644); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return "", err
+	}
+
+	if before == set.Fingerprint() || d.empty() {
+		return "", nil
+	}
+
+	warning := "stopwords changed, reindex existing documents for consistent matching"
+	d.logger.Warn(warning, slog.String("indexed", before), slog.String("current", set.Fingerprint()))
+
+	return warning, nil
+}
+
+// loadStopwords restores the stopwords last set, if any.
+func (d *IndexStorage) loadStopwords() error {
+	b, err := os.ReadFile(filepath.Join(d.dataStorage.dataDir, StopwordsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var s Stopwords
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	set := d.config.analyzer().Stopwords()
+	if set == nil {
+		return nil
+	}
+
+	set.Set(s.Words)
+	set.SetDisabled(s.Disabled)
+
+	return nil
+}
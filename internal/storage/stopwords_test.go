@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"log/slog"
+	"reflect"
+	"testing"
+
+	"github.com/farouqzaib/fast-search/internal/analyzer"
+)
+
+func TestSetStopwords(t *testing.T) {
+	dir := t.TempDir()
+
+	a, err := analyzer.New(analyzer.DefaultConfig())
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	d, err := Open(dir, IndexConfig{Analyzer: a}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	warning, err := d.SetStopwords(Stopwords{Words: []string{"a", "an"}})
+	if err != nil || warning != "" {
+		t.Fatalf("expected no warning for an empty index, got %q, %v", warning, err)
+	}
+
+	//indexing through the memtable needs the embedding service
+	d.memtables.mutable.inMemoryInvertedIndex.Index(1, "the who live")
+
+	warning, err = d.SetStopwords(Stopwords{Disabled: true})
+	if err != nil || warning == "" {
+		t.Fatalf("expected a reindex warning, got %q, %v", warning, err)
+	}
+
+	//a new analyzer picks up the persisted stopwords
+	reloaded, err := analyzer.New(analyzer.DefaultConfig())
+	if err != nil {
+		t.Fatalf("new returned an error: %v", err)
+	}
+
+	d, err = Open(dir, IndexConfig{Analyzer: reloaded}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	expected := Stopwords{Disabled: true}
+	got, err := d.Stopwords()
+
+	if err != nil || !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestSetStopwordsIndependent(t *testing.T) {
+	d, err := Open(t.TempDir(), IndexConfig{}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	other, err := Open(t.TempDir(), IndexConfig{}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	before, _ := other.Stopwords()
+
+	if _, err := d.SetStopwords(Stopwords{Words: []string{"batman"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.SetStopwords(Stopwords{Disabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	//neither another index nor the default analyzer lose their stopwords
+	after, _ := other.Stopwords()
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("expected %v, got %v", before, after)
+	}
+
+	expected := []string{"batman", "gotham"}
+	if got := analyzer.Analyze("the batman of gotham"); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
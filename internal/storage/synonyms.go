@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const SynonymsFile = "synonyms.json"
+
+var ErrNoSynonymFilter = errors.New("analyzer has no synonym filter")
+
+type synonymRules struct {
+	Rules []string `json:"rules"`
+}
+
+// Synonyms returns the synonym rules of the analyzer.
+func (d *IndexStorage) Synonyms() ([]string, error) {
+	set := d.config.analyzer().Synonyms()
+	if set == nil {
+		return nil, ErrNoSynonymFilter
+	}
+
+	return set.Rules(), nil
+}
+
+// SetSynonyms replaces the synonym rules of the analyzer and persists them so
+// they survive restarts. Synonyms applied at index time only affect
+// documents indexed from now on.
+func (d *IndexStorage) SetSynonyms(rules []string) error {
+	set := d.config.analyzer().Synonyms()
+	if set == nil {
+		return ErrNoSynonymFilter
+	}
+
+	if err := set.Set(rules); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(synonymRules{Rules: rules})
+	if err != nil {
+		return err
+	}
+
+	//write then rename so a crash never leaves a truncated file behind
+	path := filepath.Join(d.dataStorage.dataDir, SynonymsFile)
+	if err := os.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// loadSynonyms restores the synonym rules last set, if any.
+func (d *IndexStorage) loadSynonyms() error {
+	b, err := os.ReadFile(filepath.Join(d.dataStorage.dataDir, SynonymsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var r synonymRules
+	if err := json.Unmarshal(b, &r); err != nil {
+		return err
+	}
+
+	set := d.config.analyzer().Synonyms()
+	if set == nil {
+		return nil
+	}
+
+	return set.Set(r.Rules)
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"log/slog"
+	"reflect"
+	"testing"
+
+	"github.com/farouqzaib/fast-search/internal/analyzer"
+)
+
+func TestSetSynonymsIndependent(t *testing.T) {
+	d, err := Open(t.TempDir(), IndexConfig{}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	other, err := Open(t.TempDir(), IndexConfig{}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	if err := d.SetSynonyms([]string{"k8s, kubernetes"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, _ := d.Synonyms()
+	if !reflect.DeepEqual(rules, []string{"k8s, kubernetes"}) {
+		t.Fatalf("expected %v, got %v", []string{"k8s, kubernetes"}, rules)
+	}
+
+	//neither another index nor the default analyzer see the rules
+	if rules, _ := other.Synonyms(); len(rules) != 0 {
+		t.Fatalf("expected no rules, got %v", rules)
+	}
+
+	if rules := analyzer.Default().Synonyms().Rules(); len(rules) != 0 {
+		t.Fatalf("expected no rules, got %v", rules)
+	}
+}
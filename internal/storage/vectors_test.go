@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/farouqzaib/fast-search/internal/embedding"
+	"github.com/farouqzaib/fast-search/internal/index"
+)
+
+func TestIndexVectors(t *testing.T) {
+	d, err := Open(t.TempDir(), IndexConfig{Embedder: embedding.NewHashing(8)}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	if err := d.checkVector([]float64{1, 2, 3}); err != nil {
+		t.Fatalf("expected any vector to fit an empty collection, got %v", err)
+	}
+
+	if err := d.Index(1, "raft consensus", nil, nil); err != nil {
+		t.Fatalf("index returned an error: %v", err)
+	}
+
+	if d.Dimensions() != 8 {
+		t.Fatalf("expected %v, got %v", 8, d.Dimensions())
+	}
+
+	if err := d.checkVector([]float64{1, 2, 3}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("expected %v, got %v", ErrDimensionMismatch, err)
+	}
+
+	vector := []float64{0, 0, 0, 0, 0, 0, 0, 1}
+	if err := d.Index(2, "", vector, nil); err != nil {
+		t.Fatalf("index returned an error: %v", err)
+	}
+
+	vectors := d.memtables.mutable.inMemoryVectorIndex
+	if n := len(vectors.Index[len(vectors.Index)-1].Elements); n != 2 {
+		t.Fatalf("expected %v, got %v", 2, n)
+	}
+
+	if result := d.Get(context.Background(), index.Query{Vector: vector}, 10); len(result.Matches) == 0 {
+		t.Fatalf("expected a vector-only query to match")
+	}
+}
+
+type countingEmbedder struct {
+	embedding.Embedder
+	calls int
+}
+
+func (c *countingEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	c.calls++
+	return c.Embedder.Embed(ctx, text)
+}
+
+func TestGetEmbedsQueryOnce(t *testing.T) {
+	embedder := &countingEmbedder{Embedder: embedding.NewHashing(8)}
+	d, err := Open(t.TempDir(), IndexConfig{Embedder: embedder}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	d.Index(1, "raft consensus", nil, nil)
+	d.rotateMemtables()
+	d.Index(2, "raft log", nil, nil)
+
+	embedder.calls = 0
+	d.Get(context.Background(), index.Query{Text: "raft"}, 10)
+
+	if embedder.calls != 1 {
+		t.Fatalf("expected %v, got %v", 1, embedder.calls)
+	}
+}
+
+type failingEmbedder struct {
+	embedding.Embedder
+}
+
+func (f failingEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	return nil, embedding.ErrCircuitOpen
+}
+
+func TestGetFallback(t *testing.T) {
+	d, err := Open(t.TempDir(), IndexConfig{Embedder: embedding.NewHashing(8)}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	d.Index(1, "raft consensus", nil, nil)
+	d.config.Embedder = failingEmbedder{}
+
+	result := d.Get(context.Background(), index.Query{Text: "raft"}, 10)
+
+	if !result.Fallback || result.Warning != embedding.ErrCircuitOpen.Error() {
+		t.Fatalf("expected a fallback, got %v", result)
+	}
+
+	if len(result.Matches) != 1 || result.Matches[0].Offsets[0].DocumentID != 1 {
+		t.Fatalf("expected %v, got %v", 1, result.Matches)
+	}
+}
+
+func TestGetKeywordMode(t *testing.T) {
+	embedder := &countingEmbedder{Embedder: embedding.NewHashing(8)}
+	d, err := Open(t.TempDir(), IndexConfig{Embedder: embedder}, slog.Default())
+	if err != nil {
+		t.Fatalf("open returned an error: %v", err)
+	}
+
+	d.Index(1, "raft consensus", nil, nil)
+
+	embedder.calls = 0
+	result := d.Get(context.Background(), index.Query{Text: "raft", Mode: index.KeywordMode}, 10)
+
+	if embedder.calls != 0 || result.Fallback {
+		t.Fatalf("expected a keyword search not to embed the query, got %v calls", embedder.calls)
+	}
+
+	if len(result.Matches) != 1 {
+		t.Fatalf("expected %v, got %v", 1, result.Matches)
+	}
+}
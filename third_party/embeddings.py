@@ -6,9 +6,16 @@ class EmbeddingsService(abc.ABC):
     def get_embedding(text):
         pass
 
+    @abc.abstractmethod
+    def get_embeddings(texts):
+        pass
+
 class SentenceTransformerEmbeddingsService(EmbeddingsService):
     def __init__(self, model_name):
         self.bi_encoder = SentenceTransformer(model_name)
 
     def get_embedding(self, text):
-        return self.bi_encoder.encode(text).tolist()
\ No newline at end of file
+        return self.bi_encoder.encode(text).tolist()
+
+    def get_embeddings(self, texts):
+        return self.bi_encoder.encode(texts).tolist()
\ No newline at end of file
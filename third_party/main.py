@@ -1,5 +1,8 @@
 from embeddings import SentenceTransformerEmbeddingsService
 
+from functools import lru_cache
+from typing import List
+
 from fastapi import FastAPI
 from pydantic import BaseModel
 
@@ -8,12 +11,56 @@ app = FastAPI()
 class Query(BaseModel):
     text : str
 
+class Batch(BaseModel):
+    texts : List[str]
+
+class Rerank(BaseModel):
+    query : str
+    documents : List[str]
+
 embeddingService = SentenceTransformerEmbeddingsService('msmarco-distilbert-base-v4')
 
+# the reranker and the sparse model are only loaded by the first request
+# needing them, deployments without reranking or sparse retrieval never pay
+# for them
+@lru_cache(maxsize=None)
+def rerank_service():
+    from reranker import CrossEncoderRerankService
+    return CrossEncoderRerankService('cross-encoder/ms-marco-MiniLM-L-6-v2')
+
+@lru_cache(maxsize=None)
+def sparse_service():
+    from sparse import SpladeSparseEmbeddingsService
+    return SpladeSparseEmbeddingsService('naver/splade-cocondenser-ensembledistil')
+
 @app.post("/embeddings")
 async def generate_embeddings(query : Query):
     embedding = embeddingService.get_embedding(query.text)
     return {
         "status" : "success",
         "data" : embedding
+    }
+
+@app.post("/embeddings/batch")
+async def generate_batch_embeddings(batch : Batch):
+    embeddings = embeddingService.get_embeddings(batch.texts)
+    return {
+        "status" : "success",
+        "data" : embeddings
+    }
+
+@app.post("/embeddings/sparse")
+async def generate_sparse_embeddings(batch : Batch):
+    embeddings = sparse_service().get_sparse_embeddings(batch.texts)
+    return {
+        "status" : "success",
+        "data" : embeddings
+    }
+
+@app.post("/rerank")
+async def rerank(request : Rerank):
+    scores = rerank_service().get_scores(request.query, request.documents)
+    return {
+        "status" : "success",
+        "data" : scores
     }
\ No newline at end of file
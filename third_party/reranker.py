@@ -0,0 +1,16 @@
+from sentence_transformers import CrossEncoder
+import abc
+
+class RerankService(abc.ABC):
+    @abc.abstractmethod
+    def get_scores(query, documents):
+        pass
+
+class CrossEncoderRerankService(RerankService):
+    def __init__(self, model_name):
+        self.cross_encoder = CrossEncoder(model_name)
+
+    def get_scores(self, query, documents):
+        if not documents:
+            return []
+        return self.cross_encoder.predict([(query, document) for document in documents]).tolist()
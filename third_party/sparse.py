@@ -0,0 +1,33 @@
+from transformers import AutoModelForMaskedLM, AutoTokenizer
+import abc
+import torch
+
+class SparseEmbeddingsService(abc.ABC):
+    @abc.abstractmethod
+    def get_sparse_embeddings(texts):
+        pass
+
+class SpladeSparseEmbeddingsService(SparseEmbeddingsService):
+    def __init__(self, model_name):
+        self.tokenizer = AutoTokenizer.from_pretrained(model_name)
+        self.model = AutoModelForMaskedLM.from_pretrained(model_name)
+        self.model.eval()
+
+    def get_sparse_embeddings(self, texts):
+        if not texts:
+            return []
+
+        tokens = self.tokenizer(texts, return_tensors='pt', padding=True, truncation=True)
+        with torch.no_grad():
+            logits = self.model(**tokens).logits
+
+        # SPLADE max pooling of log(1 + relu(logits)) over the tokens of each text
+        weights = torch.log1p(torch.relu(logits)) * tokens['attention_mask'].unsqueeze(-1)
+        weights = torch.max(weights, dim=1).values
+
+        vectors = []
+        for row in weights:
+            indices = row.nonzero().squeeze(-1).tolist()
+            terms = self.tokenizer.convert_ids_to_tokens(indices)
+            vectors.append({term: row[i].item() for term, i in zip(terms, indices)})
+        return vectors